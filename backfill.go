@@ -0,0 +1,86 @@
+package main
+
+import (
+	"time"
+
+	"github.com/grem11n/cost-exporter/clients"
+	"github.com/grem11n/cost-exporter/config"
+	"github.com/grem11n/cost-exporter/internal/backfill"
+	"github.com/grem11n/cost-exporter/internal/remotewrite"
+	"github.com/grem11n/cost-exporter/logger"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	backfillCommand = "backfill"
+	dateFormat      = "2006-01-02"
+)
+
+// runBackfill fetches the historical metrics of all the configured queries
+// and writes them with their original timestamps to the sink.
+// Usage: cost-exporter backfill --from 2024-01-01 [--to 2025-01-01] [--sink openmetrics] [-o backfill.om]
+func runBackfill(args []string) {
+	fs := flag.NewFlagSet(backfillCommand, flag.ExitOnError)
+	configPath := fs.StringP("config", "c", "./config.yaml", "Path to the configuration file")
+	from := fs.String("from", "", "First day to backfill, e.g. 2024-01-01")
+	to := fs.String("to", "", "Day after the last day to backfill. Defaults to today")
+	sinkName := fs.String("sink", backfill.SinkOpenMetrics, "Where to write the metrics: openmetrics or remote_write")
+	output := fs.StringP("output", "o", "./backfill.om", "Path to the OpenMetrics file")
+	url := fs.String("remote-write-url", "", "Remote write endpoint, e.g. http://localhost:9090/api/v1/write")
+	headers := fs.StringToString("remote-write-header", nil, "Headers of the remote write requests, e.g. X-Scope-OrgID=tenant")
+	if err := fs.Parse(args); err != nil {
+		logger.Fatal(err)
+	}
+
+	start, err := time.Parse(dateFormat, *from)
+	if err != nil {
+		logger.Fatal("A valid --from date is required: ", err)
+	}
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	if *to != "" {
+		if end, err = time.Parse(dateFormat, *to); err != nil {
+			logger.Fatal("Invalid --to date: ", err)
+		}
+	}
+
+	conf, err := config.New(*configPath)
+	if err != nil {
+		logger.Fatal("Unable to read the config file: ", err)
+	}
+	sink, err := backfill.New(backfill.Config{
+		Sink: *sinkName,
+		Path: *output,
+		RemoteWrite: remotewrite.Config{
+			URL:     *url,
+			Headers: *headers,
+		},
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	for clientName, clientConfig := range conf.Clients {
+		constructor := clients.GetClient(clientName)
+		if constructor == nil {
+			logger.Fatalf("Client %s doesn't exist", clientName)
+		}
+		client, ok := constructor(clientConfig).(clients.Backfiller)
+		if !ok {
+			logger.Warn("Client ", clientName, " doesn't support backfill")
+			continue
+		}
+		logger.Info("Backfilling ", clientName, " from ", start.Format(dateFormat), " to ", end.Format(dateFormat))
+		if err := client.Backfill(start, end, sink.Write); err != nil {
+			// Keep what has been fetched so far, since the calls are paid
+			if cerr := sink.Close(); cerr != nil {
+				logger.Error(cerr)
+			}
+			logger.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		logger.Fatal(err)
+	}
+	logger.Info("Backfill is complete")
+}
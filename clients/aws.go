@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -13,7 +15,6 @@ import (
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
@@ -21,93 +22,232 @@ import (
 	"github.com/enriquebris/goconcurrentqueue"
 	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
 	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
 	"github.com/mitchellh/mapstructure"
 )
 
 const (
-	maxRetryCount          = 3 // maximum number of allowed retries to get AWS metrics before giving up
-	keyPrefix              = "aws"
+	defaultAccountName     = "default"
+	defaultUntaggedValue   = "untagged"
+	defaultBillingCurrency = "USD"
+	defaultNamespace       = "aws"
 	metricsPrefix          = "aws_ce"
+	estimatedLabel         = intmetrics.EstimatedLabel
+	periodStartLabel       = intmetrics.PeriodStartLabel
+	periodEndLabel         = intmetrics.PeriodEndLabel
 	awsCallsSuccessName    = "cost_exporter_aws_calls_total{job=\"cost-exporter\",result=\"success\"}"
 	awsCallsFailureName    = "cost_exporter_aws_calls_total{job=\"cost-exporter\",result=\"failure\"}"
 	getMetricsDurationName = "cost_exporter_aws_get_metrics_duration{job=\"cost-exporter\"}"
 )
 
+// Supported query types, i.e. Cost Explorer APIs
+const (
+	queryTypeCostAndUsage            = "cost_and_usage"
+	queryTypeForecast                = "forecast"
+	queryTypeReservationUtilization  = "reservation_utilization"
+	queryTypeReservationCoverage     = "reservation_coverage"
+	queryTypeSavingsPlansUtilization = "savings_plans_utilization"
+	queryTypeSavingsPlansCoverage    = "savings_plans_coverage"
+	queryTypeAnomalies               = "anomalies"
+)
+
 var (
 	awsCallsSuccess    *metrics.Counter
 	awsCallsFailure    *metrics.Counter
 	getMetricsDuration *metrics.Histogram
 	ErrGranularity     = errors.New("unsupported granularity")
+	ErrQueryType       = errors.New("unsupported query type")
+	ErrEmptyResponse   = errors.New("empty response from AWS")
+	ErrDuplicateQuery  = errors.New("duplicate query name")
 )
 
 type AWS struct {
-	AssumeRole string           `mapstructure:"assume_role"`
-	Metrics    []*MetricsConfig `mapstructure:"metrics"`
-	ce         *costexplorer.Client
-	inputs     *goconcurrentqueue.FixedFIFO
-	mu         sync.Mutex
+	namespace string
+	accounts  []*account
+	resolver  *accountResolver
+	currency  *currencyConverter
+	// Currency of the costs without a unit
+	billingCurrency string
 }
 
 type AWSConfig struct {
+	// Namespace of the metrics in the store. Converters subscribe to it
+	Namespace string `mapstructure:"namespace,omitempty"`
+	// AssumeRole is kept for backwards compatibility.
+	// It is used only if no accounts are configured
 	AssumeRole string           `mapstructure:"role,omitempty"`
+	Accounts   []*AccountConfig `mapstructure:"accounts,omitempty"`
 	Metrics    []*MetricsConfig `mapstructure:"metrics"`
+	// EndpointURL overrides the Cost Explorer endpoint, e.g. to use a local mock server
+	EndpointURL string `mapstructure:"endpoint_url,omitempty"`
+	// Mode is one of: live (default), record, replay.
+	// Responses are recorded to and replayed from the RecordingsDir
+	Mode          string       `mapstructure:"mode,omitempty"`
+	RecordingsDir string       `mapstructure:"recordings_dir,omitempty"`
+	Retry         RetryConfig  `mapstructure:"retry,omitempty"`
+	Limits        LimitsConfig `mapstructure:"limits,omitempty"`
+	// UntaggedValue is a label value for the resources
+	// without the tag or cost category used in GroupBy
+	UntaggedValue string              `mapstructure:"untagged_value,omitempty"`
+	Organizations OrganizationsConfig `mapstructure:"organizations,omitempty"`
+	Currency      CurrencyConfig      `mapstructure:"currency,omitempty"`
+	// BillingCurrency of the amounts, which Cost Explorer returns without a unit,
+	// e.g. RI and SP costs or anomaly impact. Defaults to USD. Accounts can override it
+	BillingCurrency string `mapstructure:"billing_currency,omitempty"`
+}
+
+// AccountConfig describes a single AWS account to get the metrics from.
+// Each account gets its own Cost Explorer client and its own input queue
+type AccountConfig struct {
+	Name        string `mapstructure:"name"`
+	AssumeRole  string `mapstructure:"role,omitempty"`
+	ExternalID  string `mapstructure:"external_id,omitempty"`
+	SessionName string `mapstructure:"session_name,omitempty"`
+	// BillingCurrency of the account. Defaults to the client one
+	BillingCurrency string `mapstructure:"billing_currency,omitempty"`
+}
+
+type account struct {
+	name      string
+	namespace string
+	ce        costExplorerAPI
+	inputs    *goconcurrentqueue.FixedFIFO
+	queries   []*MetricsConfig
+	untagged  string
+	resolver  *accountResolver
+	currency  *currencyConverter
+	// Currency of the costs without a unit
+	billingCurrency string
+	// Number of the inputs in a row, which were not ready, and the earliest time any of them is ready
+	notReady  int
+	nextReady time.Time
 }
 
 // MetricsConfig maps to the `costexplorer.GetCostAndUsageInput` type.
 // For more information about each field, see:
 // https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/service/costexplorer#GetCostAndUsageInput
+// Type selects the Cost Explorer API to call. Defaults to `cost_and_usage`
+// Name identifies the query. It is exported as the `query` label
+// and defaults to `query_<index>`
 type MetricsConfig struct {
-	Granularity string                  `mapstructure:"granularity"`
-	Metrics     []string                `mapstructure:"metrics"`
-	GroupBy     []types.GroupDefinition `mapstructure:"group_by"`
-	Filter      types.Expression        `mapstructure:"filter"`
+	Name                    string                  `mapstructure:"name,omitempty"`
+	MetricNamePrefix        string                  `mapstructure:"metric_name_prefix,omitempty"`
+	Help                    string                  `mapstructure:"help,omitempty"`
+	Labels                  map[string]string       `mapstructure:"labels,omitempty"`
+	Type                    string                  `mapstructure:"type,omitempty"`
+	Granularity             string                  `mapstructure:"granularity"`
+	Metrics                 []string                `mapstructure:"metrics"`
+	GroupBy                 []types.GroupDefinition `mapstructure:"group_by"`
+	Filter                  types.Expression        `mapstructure:"filter"`
+	PredictionIntervalLevel int32                   `mapstructure:"prediction_interval_level,omitempty"`
+	MonitorArns             []string                `mapstructure:"monitor_arns,omitempty"`
+	Window                  WindowConfig            `mapstructure:"window,omitempty"`
+	DropEstimated           bool                    `mapstructure:"drop_estimated,omitempty"`
 }
 
 type input struct {
 	index      int
-	ceInput    *costexplorer.GetCostAndUsageInput
+	metric     *MetricsConfig
+	breaker    *breaker
+	stale      *metrics.Gauge
 	readyTs    int64
 	retryCount int
 }
 
+// readyAt returns the time, when the input is up for refresh and its breaker allows the call
+func (in input) readyAt() time.Time {
+	readyAt := time.Unix(in.readyTs, 0)
+	if openUntil := in.breaker.openUntil(); openUntil.After(readyAt) {
+		return openUntil
+	}
+	return readyAt
+}
+
+// annotate adds the query-specific metadata to the metrics
+// Labels computed from the results take precedence over the static ones
+func (m *MetricsConfig) annotate(metrics []intmetrics.Metric, accountName string) []intmetrics.Metric {
+	for i := range metrics {
+		metrics[i].Query = m.Name
+		metrics[i].Help = m.Help
+		if m.MetricNamePrefix != "" {
+			metrics[i].Prefix = m.MetricNamePrefix
+		}
+		for k, v := range m.Labels {
+			if _, ok := metrics[i].Tags[k]; !ok {
+				metrics[i].Tags[k] = v
+			}
+		}
+		metrics[i].Tags["account"] = accountName
+		metrics[i].Tags["query"] = m.Name
+	}
+	return metrics
+}
+
+func (m *MetricsConfig) queryType() string {
+	if m.Type == "" {
+		return queryTypeCostAndUsage
+	}
+	return strings.ToLower(m.Type)
+}
+
 func init() {
 	logger.Info("Initializing AWS client")
 	Register("aws", func(conf ClientConfig) Client {
 		var cfg AWSConfig
-		if err := mapstructure.Decode(conf, &cfg); err != nil {
-			logger.Fatalf("unable to decode AWS config: %w", err)
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				windowDecodeHook,
+				mapstructure.StringToTimeDurationHookFunc(),
+			),
+			Result: &cfg,
+		})
+		if err != nil {
+			logger.Fatalf("unable to create AWS config decoder: %s", err)
+		}
+		if err := decoder.Decode(conf); err != nil {
+			logger.Fatalf("unable to decode AWS config: %s", err)
 		}
 		logger.Debug("AWS config: ", cfg)
 		ceCfg, err := config.LoadDefaultConfig(context.TODO(),
 			config.WithRegion("us-east-1"), // Const Explorer is global, hence us-east-1
 		)
 		if err != nil {
-			logger.Fatalf("unable to load AWS config: %w", err)
+			logger.Fatalf("unable to load AWS config: %s", err)
+		}
+		if cfg.Namespace == "" {
+			cfg.Namespace = defaultNamespace
+		}
+		// Each query of an account is a separate store source, so the names have to be unique
+		if err := nameQueries(cfg.Metrics); err != nil {
+			logger.Fatal("Invalid AWS metrics config: ", err)
+		}
+		client := &AWS{
+			namespace: cfg.Namespace,
+			resolver:  newAccountResolver(cfg.Organizations, newOrganizationsClient(&cfg, ceCfg)),
+			currency:  newCurrencyConverter(cfg.Currency),
 		}
-		// Assume a specific role if provided
-		if cfg.AssumeRole != "" {
-			stsClient := sts.NewFromConfig(ceCfg)
-			provider := stscreds.NewAssumeRoleProvider(stsClient, cfg.AssumeRole)
-			ceCfg.Credentials = aws.NewCredentialsCache(provider)
-			creds, err := ceCfg.Credentials.Retrieve(context.Background())
+		// Limits are shared by all accounts
+		limits := newLimiter(cfg.Limits)
+		limits.registerMetrics()
+		for _, accCfg := range accountConfigs(&cfg) {
+			ce, err := newCostExplorer(&cfg, ceCfg, accCfg, limits)
 			if err != nil {
-				logger.Errorf("unable to retrieve AWS credentials with AssumeRole: %w", err)
+				logger.Fatalf("unable to create Cost Explorer client: %s", err)
 			}
-			ceCfg.Credentials = credentials.StaticCredentialsProvider{
-				Value: aws.Credentials{
-					AccessKeyID:     creds.AccessKeyID,
-					SecretAccessKey: creds.SecretAccessKey,
-					SessionToken:    creds.SessionToken,
-					Source:          "assumerole",
-				},
-			}
-		}
-		inputs := generateInitialInputs(cfg.Metrics)
-		return &AWS{
-			ce:     costexplorer.NewFromConfig(ceCfg),
-			inputs: inputs,
-			mu:     sync.Mutex{},
+			client.accounts = append(client.accounts, &account{
+				name:      accCfg.Name,
+				namespace: cfg.Namespace,
+				ce:        ce,
+				inputs:    generateInitialInputs(accCfg.Name, cfg.Metrics, cfg.Retry),
+				queries:   cfg.Metrics,
+				untagged:  cfg.UntaggedValue,
+				resolver:  client.resolver,
+				currency:  client.currency,
+
+				billingCurrency: accCfg.BillingCurrency,
+			})
 		}
+		return client
 	})
 	// Maybe initiate all the metrics in a loop if there are too many
 	logger.Info("Initializing AWS Client metrics")
@@ -116,101 +256,327 @@ func init() {
 	getMetricsDuration = intmetrics.InternalMetricsSet.GetOrCreateHistogram(getMetricsDurationName)
 }
 
-func (a *AWS) GetMetrics(cache *sync.Map) {
-	for {
-		a.getCostAndUsageMetrics(cache)
+// accountConfigs returns the list of accounts to get the metrics from.
+// If no accounts are configured, a single default account is used
+// with the top-level role, if any
+func accountConfigs(cfg *AWSConfig) []*AccountConfig {
+	currency := strings.ToUpper(cfg.BillingCurrency)
+	if currency == "" {
+		currency = defaultBillingCurrency
+	}
+	if len(cfg.Accounts) == 0 {
+		return []*AccountConfig{{Name: defaultAccountName, AssumeRole: cfg.AssumeRole, BillingCurrency: currency}}
+	}
+	for i, acc := range cfg.Accounts {
+		if acc.Name == "" {
+			acc.Name = fmt.Sprintf("account_%d", i)
+		}
+		acc.BillingCurrency = strings.ToUpper(acc.BillingCurrency)
+		if acc.BillingCurrency == "" {
+			acc.BillingCurrency = currency
+		}
+	}
+	return cfg.Accounts
+}
+
+// newCostExplorer returns a Cost Explorer client for the account depending on the mode.
+// Recordings of each account are stored in a separate directory
+func newCostExplorer(cfg *AWSConfig, base aws.Config, acc *AccountConfig, limits *limiter) (costExplorerAPI, error) {
+	dir := cfg.RecordingsDir
+	if dir == "" {
+		dir = defaultRecordingsDir
+	}
+	dir = filepath.Join(dir, acc.Name)
+
+	switch strings.ToLower(cfg.Mode) {
+	case modeReplay:
+		logger.Infof("Replaying Cost Explorer responses for account %s from %s", acc.Name, dir)
+		return newRecorder(dir, nil), nil
+	case modeRecord:
+		logger.Infof("Recording Cost Explorer responses for account %s to %s", acc.Name, dir)
+		return newRecorder(dir, liveCostExplorer(cfg, base, acc, limits)), nil
+	case "", modeLive:
+		return liveCostExplorer(cfg, base, acc, limits), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrMode, cfg.Mode)
+	}
+}
+
+// liveCostExplorer returns a Cost Explorer client, which calls AWS within the limits.
+// Replayed responses are free, so the limits apply to the live client only
+func liveCostExplorer(cfg *AWSConfig, base aws.Config, acc *AccountConfig, limits *limiter) costExplorerAPI {
+	ce := costexplorer.NewFromConfig(accountAWSConfig(base, acc), func(o *costexplorer.Options) {
+		if cfg.EndpointURL != "" {
+			o.BaseEndpoint = aws.String(cfg.EndpointURL)
+		}
+	})
+	return &limitedCostExplorer{ce: ce, limiter: limits}
+}
+
+// accountAWSConfig returns a copy of the base AWS config
+// with the credentials for the given account
+func accountAWSConfig(base aws.Config, acc *AccountConfig) aws.Config {
+	cfg := base.Copy()
+	// Assume a specific role if provided
+	if acc.AssumeRole == "" {
+		return cfg
 	}
+	stsClient := sts.NewFromConfig(base)
+	provider := stscreds.NewAssumeRoleProvider(stsClient, acc.AssumeRole, func(o *stscreds.AssumeRoleOptions) {
+		if acc.ExternalID != "" {
+			o.ExternalID = aws.String(acc.ExternalID)
+		}
+		if acc.SessionName != "" {
+			o.RoleSessionName = acc.SessionName
+		}
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	// Retrieve the credentials early to report misconfigured roles on start
+	if _, err := cfg.Credentials.Retrieve(context.Background()); err != nil {
+		logger.Errorf("unable to retrieve AWS credentials with AssumeRole for account %s: %s", acc.Name, err)
+	}
+	return cfg
 }
 
-func (a *AWS) getCostAndUsageMetrics(cache *sync.Map) {
+// Namespace returns the store namespace of the AWS metrics
+func (a *AWS) Namespace() string {
+	return a.namespace
+}
+
+func (a *AWS) GetMetrics(st *store.Store) {
+	// Get the accounts first, so the first metrics already have their names and OUs
+	a.resolver.update()
+	go a.resolver.run()
+	go a.currency.run()
+	var wg sync.WaitGroup
+	for _, acc := range a.accounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				acc.getMetrics(st)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (a *account) getMetrics(st *store.Store) {
 	startTs := time.Now()
-	var results []costexplorer.GetCostAndUsageOutput
 	obj, err := a.inputs.DequeueOrWaitForNextElement()
-	// this type cast should be safe, since we control inputs
-	in := obj.(input) //nolint:forcetypeassert
 	if err != nil {
 		logger.Error(err)
 		return
 	}
-	if in.retryCount > maxRetryCount {
-		logger.Fatalf("Cannot get CostAndUsage metrics", err)
-	}
+	// this type cast should be safe, since we control inputs
+	in := obj.(input) //nolint:forcetypeassert
 	// Check if the metrics are up for refresh
-	if in.readyTs > time.Now().Unix() {
+	if in.readyTs > time.Now().Unix() || !in.breaker.allow(time.Now()) {
 		// Put the input back in the queue
 		a.enqueuWithTs(in, in.readyTs, in.retryCount)
+		a.waitReady(in.readyAt())
 		return
 	}
+	a.notReady = 0
 
-	logger.Info("Making a call to AWS")
-	out := a.costAndUsageCall(in)
-	if out == nil {
-		// We have already enqueued a retry
+	logger.Infof("Making a call to AWS for account %s", a.name)
+	metrics, err := a.fetch(in.metric)
+	if errors.Is(err, ErrBudgetExceeded) {
+		// Stop refreshing until the next scheduled refresh,
+		// the data in the store is stale meanwhile
+		logger.Warnf("Skipping refresh of query %s: %v", in.metric.Name, err)
+		in.stale.Set(1)
+		a.enqueuWithTs(in, nextRefreshTs(in.metric), in.retryCount)
 		return
 	}
+	if err != nil {
+		// The last good metrics stay in the store until the query recovers
+		nextRetry := in.breaker.failure(time.Now())
+		logger.Errorf("Cannot get metrics from AWS for query %s, retry %d at %s: %v",
+			in.metric.Name, in.retryCount, nextRetry.Format(time.RFC3339), err)
+		a.enqueuWithTs(in, nextRetry.Unix(), in.retryCount+1)
+		return
+	}
+	in.breaker.success()
+	in.stale.Set(0)
+	a.enqueuWithTs(in, nextRefreshTs(in.metric), 0)
 
-	a.mu.Lock()
-	results = append(results, *out)
-	a.mu.Unlock()
+	a.put(st, in.metric, metrics)
+	getMetricsDuration.UpdateDuration(startTs)
+}
 
-	for out.NextPageToken != nil {
-		in.ceInput.NextPageToken = out.NextPageToken
-		out = a.costAndUsageCall(in)
-		a.mu.Lock()
-		results = append(results, *out)
-		a.mu.Unlock()
+// waitReady sleeps until the earliest input is ready once none of the inputs in the queue are,
+// so the account does not spin on the queue between the refreshes or while the breakers are open
+func (a *account) waitReady(readyAt time.Time) {
+	if a.notReady == 0 || readyAt.Before(a.nextReady) {
+		a.nextReady = readyAt
 	}
-	// There is no need to delay for the whole month
-	readyTs := time.Now().Add(24 * time.Hour).Unix()
-	// If we need hourly metrics, we need to fetch them every hour
-	if strings.EqualFold(string(in.ceInput.Granularity), "hourly") {
-		readyTs = time.Now().Add(1 * time.Hour).Unix()
+	a.notReady++
+	if a.notReady < a.inputs.GetLen() {
+		return
 	}
-	a.enqueuWithTs(in, readyTs, 0)
-	logger.Debug("Converting metrics into the internal format")
-	metrics := convert(results)
-	key := fmt.Sprintf("%s_%d", keyPrefix, in.index)
-	logger.Debugf("Adding AWS metrics to the cache. Key: %s", key)
-	intmetrics.AddMetrics(cache, "aws", metrics)
+	time.Sleep(time.Until(a.nextReady))
+	a.notReady = 0
+}
+
+// GetMetricsOnce fetches all the queries of all the accounts once.
+// Failed queries are skipped, so the metrics of the others are still in the store
+func (a *AWS) GetMetricsOnce(st *store.Store) error {
+	a.resolver.update()
+	var errs []error
+	for _, acc := range a.accounts {
+		for _, metric := range acc.queries {
+			// Invalid queries are reported on start
+			if metric.validate() != nil {
+				continue
+			}
+			logger.Infof("Making a call to AWS for query %s of account %s", metric.Name, acc.name)
+			metrics, err := acc.fetch(metric)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("query %s of account %s: %w", metric.Name, acc.name, err))
+				continue
+			}
+			acc.put(st, metric, metrics)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// put annotates the metrics of the query and puts them into the store
+func (a *account) put(st *store.Store, metric *MetricsConfig, metrics []intmetrics.Metric) {
+	a.resolver.annotate(metrics)
+	a.currency.normalize(metrics)
+	metrics = metric.annotate(metrics, a.name)
+	// Each query of each account is a separate source,
+	// so its metrics are replaced at once
+	source := fmt.Sprintf("%s/%s", a.name, metric.Name)
+	logger.Debugf("Adding AWS metrics to the store. Source: %s", source)
+	st.Put(a.namespace, source, metrics)
 	logger.Debug("Metrics: ", metrics)
-	getMetricsDuration.UpdateDuration(startTs)
 }
 
-func (a *AWS) costAndUsageCall(in input) *costexplorer.GetCostAndUsageOutput {
-	out, err := a.ce.GetCostAndUsage(context.TODO(), in.ceInput)
+// fetch makes all the calls required by the query
+// and converts the results into the internal format
+func (a *account) fetch(metric *MetricsConfig) ([]intmetrics.Metric, error) {
+	switch metric.queryType() {
+	case queryTypeCostAndUsage:
+		return a.fetchCostAndUsage(metric)
+	case queryTypeForecast:
+		return a.fetchForecast(metric)
+	case queryTypeReservationUtilization:
+		return a.fetchReservationUtilization(metric)
+	case queryTypeReservationCoverage:
+		return a.fetchReservationCoverage(metric)
+	case queryTypeSavingsPlansUtilization:
+		return a.fetchSavingsPlansUtilization(metric)
+	case queryTypeSavingsPlansCoverage:
+		return a.fetchSavingsPlansCoverage(metric)
+	case queryTypeAnomalies:
+		return a.fetchAnomalies(metric)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrQueryType, metric.Type)
+	}
+}
+
+func (a *account) fetchCostAndUsage(metric *MetricsConfig) ([]intmetrics.Metric, error) {
+	var results []costexplorer.GetCostAndUsageOutput
+	ceInput, err := buildCostAndUsageInput(metric, nil)
 	if err != nil {
-		logger.Error("Cannot get CostAndUsage metrics", err, in.retryCount)
-		awsCallsFailure.Inc()
-		// Insert 10 sec delay before retry
-		readyTs := time.Now().Add(10 * time.Second).Unix()
-		retry := in.retryCount + 1
-		a.enqueuWithTs(in, readyTs, retry)
-		return nil
+		return nil, err
 	}
+	for {
+		out, err := a.ce.GetCostAndUsage(context.TODO(), ceInput)
+		if err := countCall(out == nil, err); err != nil {
+			return nil, err
+		}
+		results = append(results, *out)
+		if out.NextPageToken == nil {
+			break
+		}
+		ceInput.NextPageToken = out.NextPageToken
+	}
+	logger.Debug("Converting metrics into the internal format")
+	metrics := convert(results, a.untagged)
+	if metric.DropEstimated {
+		metrics = dropEstimated(metrics)
+	}
+	return metrics, nil
+}
 
-	if out == nil {
-		// TODO: Should we exit here instead?
-		logger.Error("CostAndUsage metrics are empty")
+// countCall updates the AWS calls metrics
+// and returns an error if the call has failed
+func countCall(empty bool, err error) error {
+	// No call has been made at all
+	if errors.Is(err, ErrBudgetExceeded) {
+		return err
+	}
+	if err != nil {
+		awsCallsFailure.Inc()
+		return err
+	}
+	if empty {
 		awsCallsFailure.Inc()
-		readyTs := time.Now().Add(10 * time.Second).Unix()
-		retry := in.retryCount + 1
-		a.enqueuWithTs(in, readyTs, retry)
-		return nil
+		return ErrEmptyResponse
 	}
 	awsCallsSuccess.Inc()
-	return out
+	return nil
+}
+
+// nextRefreshTs returns the time when the query should be refreshed
+func nextRefreshTs(metric *MetricsConfig) int64 {
+	return time.Now().Add(refreshInterval(metric)).Unix()
 }
 
-func generateInitialInputs(metrics []*MetricsConfig) *goconcurrentqueue.FixedFIFO {
+func refreshInterval(metric *MetricsConfig) time.Duration {
+	// If we need hourly metrics, we need to fetch them every hour
+	if strings.EqualFold(metric.Granularity, "hourly") {
+		return 1 * time.Hour
+	}
+	// There is no need to delay for the whole month
+	return 24 * time.Hour
+}
+
+// RefreshInterval returns the longest refresh interval of the queries
+func (a *AWS) RefreshInterval() time.Duration {
+	var res time.Duration
+	for _, acc := range a.accounts {
+		for _, metric := range acc.queries {
+			res = max(res, refreshInterval(metric))
+		}
+	}
+	return res
+}
+
+// nameQueries sets the default names of the queries, e.g. `query_1`,
+// and checks that the names are unique
+func nameQueries(metrics []*MetricsConfig) error {
+	names := map[string]bool{}
+	for i, metric := range metrics {
+		if metric.Name == "" {
+			metric.Name = fmt.Sprintf("query_%d", i)
+		}
+		if names[metric.Name] {
+			return fmt.Errorf("%w: %s", ErrDuplicateQuery, metric.Name)
+		}
+		names[metric.Name] = true
+	}
+	return nil
+}
+
+func generateInitialInputs(accountName string, metrics []*MetricsConfig, retry RetryConfig) *goconcurrentqueue.FixedFIFO {
 	inputs := goconcurrentqueue.NewFixedFIFO(len(metrics))
 	for i, metric := range metrics {
-		el, err := buildCostAndUsageInput(metric, nil)
-		if err != nil {
-			logger.Errorf("Cannot build AWS CostAndUsageInput", err)
+		if err := metric.validate(); err != nil {
+			logger.Errorf("Skipping invalid AWS metrics config: %s", err)
+			continue
 		}
 		inp := input{
-			index:      i,
-			ceInput:    el,
+			index:   i,
+			metric:  metric,
+			breaker: newBreaker(accountName, metric.Name, retry),
+			stale: intmetrics.InternalMetricsSet.GetOrCreateGauge(
+				fmt.Sprintf(dataStaleName, accountName, metric.Name), nil,
+			),
 			readyTs:    time.Now().Unix(),
 			retryCount: 0,
 		}
@@ -221,58 +587,52 @@ func generateInitialInputs(metrics []*MetricsConfig) *goconcurrentqueue.FixedFIF
 	return inputs
 }
 
+// validate checks the query config before it gets into the queue
+func (m *MetricsConfig) validate() error {
+	switch m.queryType() {
+	case queryTypeCostAndUsage:
+		_, err := buildCostAndUsageInput(m, nil)
+		return err
+	case queryTypeForecast:
+		_, err := buildCostForecastInputs(m)
+		return err
+	case queryTypeReservationUtilization, queryTypeReservationCoverage,
+		queryTypeSavingsPlansUtilization, queryTypeSavingsPlansCoverage:
+		_, _, err := commitmentPeriod(m, len(m.GroupBy) > 0)
+		return err
+	case queryTypeAnomalies:
+		_, err := buildAnomaliesInputs(m)
+		return err
+	default:
+		return fmt.Errorf("%w: %s", ErrQueryType, m.Type)
+	}
+}
+
 // Build the input separately, since filters cannot be empty when making a query
 // But they can be empty in the config
 func buildCostAndUsageInput(metric *MetricsConfig, pageToken *string) (*costexplorer.GetCostAndUsageInput, error) {
-	nowUtc := time.Now().UTC()
-	var endDate string
-	var startDate string
-
-	// AWS requires different time formats depending on granularity
-	switch strings.ToLower(metric.Granularity) {
-	case "monthly":
-		interval, _ := time.ParseDuration("730h") //nolint:errcheck
-		endDate = nowUtc.Format("2006-01-02")
-		startDate = nowUtc.Add(-interval).Format("2006-01-02")
-	case "daily":
-		interval, _ := time.ParseDuration("24h") //nolint:errcheck
-		endDate = nowUtc.Format("2006-01-02")
-		startDate = nowUtc.Add(-interval).Format("2006-01-02")
-	case "hourly":
-		interval, _ := time.ParseDuration("1h") //nolint:errcheck
-		endDate = nowUtc.Format(time.RFC3339)
-		startDate = nowUtc.Add(-interval).Format(time.RFC3339)
-	default:
-		logger.Errorf("unsupported granularity: %s. Supported: monthly, daily, hourly", metric.Granularity)
-		return nil, ErrGranularity
-	}
-
-	if reflect.ValueOf(metric.Filter).IsZero() {
-		return &costexplorer.GetCostAndUsageInput{
-			TimePeriod: &types.DateInterval{
-				Start: aws.String(startDate),
-				End:   aws.String(endDate),
-			},
-			Granularity:   types.Granularity(strings.ToUpper(metric.Granularity)),
-			Metrics:       metric.Metrics,
-			GroupBy:       metric.GroupBy,
-			NextPageToken: pageToken,
-		}, nil
-	}
-	return &costexplorer.GetCostAndUsageInput{
-		TimePeriod: &types.DateInterval{
-			Start: aws.String(startDate),
-			End:   aws.String(endDate),
-		},
+	period, err := timePeriod(metric)
+	if err != nil {
+		return nil, err
+	}
+	ceInput := &costexplorer.GetCostAndUsageInput{
+		TimePeriod:    period,
 		Granularity:   types.Granularity(strings.ToUpper(metric.Granularity)),
 		Metrics:       metric.Metrics,
 		GroupBy:       metric.GroupBy,
-		Filter:        &metric.Filter,
 		NextPageToken: pageToken,
-	}, nil
+	}
+	if !isZeroExpression(metric.Filter) {
+		ceInput.Filter = &metric.Filter
+	}
+	return ceInput, nil
 }
 
-func (a *AWS) enqueuWithTs(in input, ts int64, retries int) {
+func isZeroExpression(e types.Expression) bool {
+	return reflect.ValueOf(e).IsZero()
+}
+
+func (a *account) enqueuWithTs(in input, ts int64, retries int) {
 	in.readyTs = ts
 	in.retryCount = retries
 	if err := a.inputs.Enqueue(in); err != nil {
@@ -281,26 +641,121 @@ func (a *AWS) enqueuWithTs(in input, ts int64, retries int) {
 }
 
 // Converts AWS metrics into the internal format
-func convert(awsOut []costexplorer.GetCostAndUsageOutput) []intmetrics.Metric {
+func convert(awsOut []costexplorer.GetCostAndUsageOutput, untagged string) []intmetrics.Metric {
 	metrics := []intmetrics.Metric{}
 	for _, a := range awsOut {
-		for _, g := range a.ResultsByTime[0].Groups {
-			for mName := range g.Metrics {
-				dimension := g.Keys[0]
-				value, err := strconv.ParseFloat(*g.Metrics[mName].Amount, 64)
-				if err != nil {
-					logger.Error("cannot parse metric value: ", err)
-					break
-				}
-				metric := intmetrics.Metric{
-					Name:   mName,
-					Prefix: metricsPrefix,
-					Tags:   map[string]string{"dimension": dimension},
-					Value:  value,
+		for _, r := range a.ResultsByTime {
+			tags := periodTags(r.TimePeriod)
+			// Recent buckets are estimated and may change for up to 48 hours
+			tags[estimatedLabel] = strconv.FormatBool(r.Estimated)
+			// Results are not grouped if GroupBy is not set. Only totals are available then
+			if len(r.Groups) == 0 {
+				metrics = append(metrics, convertMetricValues(r.Total, tags)...)
+				continue
+			}
+			for _, g := range r.Groups {
+				groupTags := maps.Clone(tags)
+				for i, key := range g.Keys {
+					groupTags[groupLabel(a.GroupDefinitions, i)] = groupValue(a.GroupDefinitions, i, key, untagged)
 				}
-				metrics = append(metrics, metric)
+				metrics = append(metrics, convertMetricValues(g.Metrics, groupTags)...)
 			}
 		}
 	}
 	return metrics
 }
+
+// dropEstimated removes the metrics of the estimated buckets
+func dropEstimated(metrics []intmetrics.Metric) []intmetrics.Metric {
+	final := []intmetrics.Metric{}
+	for _, m := range metrics {
+		if m.Tags[estimatedLabel] == "true" {
+			continue
+		}
+		final = append(final, m)
+	}
+	return final
+}
+
+func convertMetricValues(values map[string]types.MetricValue, tags map[string]string) []intmetrics.Metric {
+	metrics := []intmetrics.Metric{}
+	for mName, mValue := range values {
+		if mValue.Amount == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(*mValue.Amount, 64)
+		if err != nil {
+			logger.Error("cannot parse metric value: ", err)
+			continue
+		}
+		metric := intmetrics.Metric{
+			Name:   mName,
+			Prefix: metricsPrefix,
+			Unit:   aws.ToString(mValue.Unit),
+			Tags:   maps.Clone(tags),
+			Value:  value,
+		}
+		if intmetrics.IsCurrency(metric.Unit) {
+			metric.Tags[currencyLabel] = metric.Unit
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// groupLabel returns a label name for the i-th group key
+// based on its group definition, e.g. `service` or `tag_team`
+func groupLabel(defs []types.GroupDefinition, i int) string {
+	if i >= len(defs) || defs[i].Key == nil {
+		return fmt.Sprintf("dimension_%d", i)
+	}
+	key := intmetrics.SanitizeName(strings.ToLower(*defs[i].Key))
+	switch defs[i].Type {
+	case types.GroupDefinitionTypeTag:
+		return "tag_" + key
+	case types.GroupDefinitionTypeCostCategory:
+		return "cost_category_" + key
+	default:
+		return key
+	}
+}
+
+// groupValue returns a label value for the i-th group key.
+// Tags and cost categories come as `key$value`, e.g. `team$payments`.
+// Resources without the tag or the cost category have an empty value
+func groupValue(defs []types.GroupDefinition, i int, key string, untagged string) string {
+	if i >= len(defs) {
+		return key
+	}
+	switch defs[i].Type {
+	case types.GroupDefinitionTypeTag, types.GroupDefinitionTypeCostCategory:
+		if _, value, found := strings.Cut(key, "$"); found {
+			key = value
+		}
+		if key == "" {
+			if untagged == "" {
+				return defaultUntaggedValue
+			}
+			return untagged
+		}
+		return key
+	default:
+		return key
+	}
+}
+
+// periodTags returns the tags describing a time bucket
+// Each bucket gets its own set of series, so the buckets don't overwrite each other
+func periodTags(period *types.DateInterval) map[string]string {
+	tags := map[string]string{}
+	if period == nil {
+		return tags
+	}
+	if period.Start != nil {
+		tags[periodStartLabel] = *period.Start
+	}
+	if period.End != nil {
+		tags[periodEndLabel] = *period.End
+	}
+	return tags
+}
@@ -0,0 +1,141 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+)
+
+// This file implements Cost Anomaly Detection queries
+
+const (
+	anomaliesLookback = 7 * 24 * time.Hour
+	// An anomaly is considered resolved
+	// if it hasn't been detected for longer than that
+	anomalyResolvedAfter = 24 * time.Hour
+)
+
+var ErrMonitorArns = errors.New("anomalies query requires at least one monitor ARN")
+
+func (a *account) fetchAnomalies(metric *MetricsConfig) ([]intmetrics.Metric, error) {
+	ceInputs, err := buildAnomaliesInputs(metric)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []intmetrics.Metric{}
+	for _, ceInput := range ceInputs {
+		for {
+			out, err := a.ce.GetAnomalies(context.TODO(), ceInput)
+			if err := countCall(out == nil, err); err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, convertAnomalies(out, a.billingCurrency, time.Now().UTC())...)
+			if out.NextPageToken == nil {
+				break
+			}
+			ceInput.NextPageToken = out.NextPageToken
+		}
+	}
+	return metrics, nil
+}
+
+// buildAnomaliesInputs returns an input for each configured monitor
+func buildAnomaliesInputs(metric *MetricsConfig) ([]*costexplorer.GetAnomaliesInput, error) {
+	if len(metric.MonitorArns) == 0 {
+		return nil, ErrMonitorArns
+	}
+	nowUtc := time.Now().UTC()
+	interval := &types.AnomalyDateInterval{
+		StartDate: aws.String(nowUtc.Add(-anomaliesLookback).Format("2006-01-02")),
+		EndDate:   aws.String(nowUtc.Format("2006-01-02")),
+	}
+	// Anomalies are reported daily, thus the window is resolved with the daily granularity
+	if metric.Window.windowType() != "" {
+		period, err := metric.Window.resolve(nowUtc, "daily")
+		if err != nil {
+			return nil, err
+		}
+		interval = &types.AnomalyDateInterval{StartDate: period.Start, EndDate: period.End}
+	}
+	inputs := []*costexplorer.GetAnomaliesInput{}
+	for _, arn := range metric.MonitorArns {
+		inputs = append(inputs, &costexplorer.GetAnomaliesInput{
+			MonitorArn:   aws.String(arn),
+			DateInterval: interval,
+		})
+	}
+	return inputs, nil
+}
+
+// convertAnomalies exports the impact and the state of each anomaly.
+// Root cause labels are taken from the most significant root cause.
+// The impact is in the billing currency
+func convertAnomalies(out *costexplorer.GetAnomaliesOutput, currency string, now time.Time) []intmetrics.Metric {
+	metrics := []intmetrics.Metric{}
+	for _, anomaly := range out.Anomalies {
+		if anomaly.AnomalyId == nil || anomaly.Impact == nil {
+			continue
+		}
+		tags := map[string]string{"anomaly_id": *anomaly.AnomalyId}
+		if anomaly.MonitorArn != nil {
+			tags["monitor_arn"] = *anomaly.MonitorArn
+		}
+		if len(anomaly.RootCauses) > 0 {
+			rootCause := anomaly.RootCauses[0]
+			for label, value := range map[string]*string{
+				"service":        rootCause.Service,
+				"linked_account": rootCause.LinkedAccount,
+				"region":         rootCause.Region,
+			} {
+				if value != nil {
+					tags[label] = *value
+				}
+			}
+		}
+		active := 0.0
+		if anomalyActive(anomaly, now) {
+			active = 1
+		}
+		for name, value := range map[string]float64{
+			"AnomalyImpact":    anomaly.Impact.TotalImpact,
+			"AnomalyMaxImpact": anomaly.Impact.MaxImpact,
+		} {
+			impactTags := maps.Clone(tags)
+			impactTags[currencyLabel] = currency
+			metrics = append(metrics, intmetrics.Metric{
+				Name:   name,
+				Prefix: metricsPrefix,
+				Unit:   currency,
+				Tags:   impactTags,
+				Value:  value,
+			})
+		}
+		metrics = append(metrics, intmetrics.Metric{
+			Name:   "AnomalyActive",
+			Prefix: metricsPrefix,
+			Tags:   maps.Clone(tags),
+			Value:  active,
+		})
+	}
+	return metrics
+}
+
+// anomalyActive reports whether the anomaly is still ongoing.
+// Cost Explorer doesn't have an explicit state,
+// so an anomaly is active until it is not detected for a while
+func anomalyActive(anomaly types.Anomaly, now time.Time) bool {
+	if anomaly.AnomalyEndDate == nil || *anomaly.AnomalyEndDate == "" {
+		return true
+	}
+	end, err := time.Parse("2006-01-02", (*anomaly.AnomalyEndDate)[:min(len(*anomaly.AnomalyEndDate), 10)])
+	if err != nil {
+		return true
+	}
+	return now.Sub(end) < anomalyResolvedAfter
+}
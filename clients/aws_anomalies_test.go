@@ -0,0 +1,71 @@
+package clients
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildAnomaliesInputs(t *testing.T) {
+	_, err := buildAnomaliesInputs(&MetricsConfig{Type: queryTypeAnomalies})
+	assert.ErrorIs(t, err, ErrMonitorArns)
+
+	got, err := buildAnomaliesInputs(&MetricsConfig{
+		Type:        queryTypeAnomalies,
+		MonitorArns: []string{"arn:aws:ce::111111111111:anomalymonitor/a", "arn:aws:ce::111111111111:anomalymonitor/b"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Equal(t, "arn:aws:ce::111111111111:anomalymonitor/b", *got[1].MonitorArn)
+}
+
+func TestConvertAnomalies(t *testing.T) {
+	now := time.Date(2024, 10, 10, 12, 0, 0, 0, time.UTC)
+	out := costexplorer.GetAnomaliesOutput{
+		Anomalies: []types.Anomaly{
+			{
+				AnomalyId:      aws.String("active"),
+				AnomalyEndDate: aws.String("2024-10-10"),
+				Impact:         &types.Impact{TotalImpact: 120, MaxImpact: 80},
+				RootCauses: []types.RootCause{
+					{
+						Service:       aws.String("Amazon Elastic Compute Cloud - Compute"),
+						LinkedAccount: aws.String("111111111111"),
+						Region:        aws.String("us-east-1"),
+					},
+				},
+			},
+			{
+				AnomalyId:      aws.String("resolved"),
+				AnomalyEndDate: aws.String("2024-10-01"),
+				Impact:         &types.Impact{TotalImpact: 10, MaxImpact: 5},
+			},
+		},
+	}
+	got := convertAnomalies(&out, "USD", now)
+	assert.Len(t, got, 6)
+	values := map[string]float64{}
+	for _, m := range got {
+		values[m.Tags["anomaly_id"]+"/"+m.Name] = m.Value
+		if m.Tags["anomaly_id"] == "active" {
+			assert.Equal(t, "111111111111", m.Tags["linked_account"])
+			assert.Equal(t, "us-east-1", m.Tags["region"])
+		}
+	}
+	assert.InDelta(t, 1.0, values["active/AnomalyActive"], 0.0001)
+	assert.InDelta(t, 120.0, values["active/AnomalyImpact"], 0.0001)
+	assert.InDelta(t, 0.0, values["resolved/AnomalyActive"], 0.0001)
+	assert.InDelta(t, 5.0, values["resolved/AnomalyMaxImpact"], 0.0001)
+	for _, m := range got {
+		if m.Name == "AnomalyActive" {
+			assert.NotContains(t, m.Tags, currencyLabel)
+			continue
+		}
+		assert.Equal(t, "USD", m.Unit)
+		assert.Equal(t, "USD", m.Tags[currencyLabel])
+	}
+}
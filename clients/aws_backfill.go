@@ -0,0 +1,110 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/logger"
+)
+
+// This file implements the backfill of the historical metrics
+
+var (
+	ErrBackfill = errors.New("backfill failed")
+)
+
+// Backfill fetches the metrics of all the queries between from and to
+// and writes them with the end of their buckets as timestamps like the live converters.
+// The period is split into windows, so each window is a single query.
+// Forecasts and anomalies are skipped, since they have no history
+func (a *AWS) Backfill(from, to time.Time, write func([]intmetrics.Metric) error) error {
+	a.resolver.update()
+	for _, acc := range a.accounts {
+		if err := acc.backfill(from, to, write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *account) backfill(from, to time.Time, write func([]intmetrics.Metric) error) error {
+	for _, metric := range a.queries {
+		switch metric.queryType() {
+		case queryTypeForecast, queryTypeAnomalies:
+			logger.Info("Skipping backfill of query ", metric.Name)
+			continue
+		}
+		if err := metric.validate(); err != nil {
+			logger.Error("Skipping backfill of invalid query ", metric.Name, ": ", err)
+			continue
+		}
+		for _, window := range backfillWindows(from, to, metric.Granularity) {
+			query := *metric
+			query.Window = window
+			metrics, err := a.fetch(&query)
+			if err != nil {
+				return fmt.Errorf("%w: query %s of account %s, %s - %s: %w",
+					ErrBackfill, metric.Name, a.name, window.Start, window.End, err)
+			}
+			a.resolver.annotate(metrics)
+			a.currency.normalize(metrics)
+			metrics = withTimestamps(query.annotate(metrics, a.name), time.Now())
+			if err := write(metrics); err != nil {
+				return fmt.Errorf("%w: %w", ErrBackfill, err)
+			}
+			logger.Infof("Backfilled %d metrics of query %s of account %s, %s - %s",
+				len(metrics), metric.Name, a.name, window.Start, window.End)
+		}
+	}
+	return nil
+}
+
+// backfillWindows splits the period into fixed windows.
+// The windows are as large as possible to make fewer calls,
+// but Cost Explorer returns hourly data for up to 14 days only
+func backfillWindows(from, to time.Time, granularity string) []WindowConfig {
+	step := func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	switch strings.ToLower(granularity) {
+	case "hourly":
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "monthly":
+		step = func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+	}
+	windows := []WindowConfig{}
+	for start := from; start.Before(to); {
+		end := step(start)
+		if end.After(to) {
+			end = to
+		}
+		windows = append(windows, WindowConfig{
+			Start: formatDate(start, granularity),
+			End:   formatDate(end, granularity),
+		})
+		start = end
+	}
+	return windows
+}
+
+// withTimestamps timestamps the metrics with the end of their buckets.
+// The labels are kept, so the backfilled series are the same as the live ones.
+// Buckets of the current period are timestamped with now like in the remote_write converter.
+// Metrics without a period cannot be placed in time and are dropped
+func withTimestamps(metrics []intmetrics.Metric, now time.Time) []intmetrics.Metric {
+	res := []intmetrics.Metric{}
+	for _, m := range metrics {
+		ts, ok := m.Period(periodEndLabel)
+		if !ok {
+			logger.Debug("Dropping metric without a period: ", m)
+			continue
+		}
+		m.Timestamp = ts
+		if ts.After(now) {
+			m.Timestamp = now
+		}
+		res = append(res, m)
+	}
+	return res
+}
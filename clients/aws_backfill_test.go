@@ -0,0 +1,111 @@
+package clients
+
+import (
+	"testing"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/internal/remotewrite"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfillWindows(t *testing.T) {
+	from := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []WindowConfig{
+		{Start: "2024-01-15", End: "2024-02-15"},
+		{Start: "2024-02-15", End: "2024-03-01"},
+	}, backfillWindows(from, to, "daily"))
+	assert.Equal(t, []WindowConfig{
+		{Start: "2024-01-15", End: "2024-03-01"},
+	}, backfillWindows(from, to, "monthly"))
+	assert.Len(t, backfillWindows(from, to, "hourly"), 46)
+	assert.Empty(t, backfillWindows(to, from, "daily"))
+}
+
+func TestWithTimestamps(t *testing.T) {
+	now := time.Date(2024, 10, 15, 12, 0, 0, 0, time.UTC)
+	tags := map[string]string{periodStartLabel: "2024-10-01", periodEndLabel: "2024-10-02", estimatedLabel: "false", "service": "S3"}
+	got := withTimestamps([]intmetrics.Metric{
+		{Tags: tags},
+		{Tags: map[string]string{periodStartLabel: "2024-10-01T10:00:00Z", periodEndLabel: "2024-10-01T11:00:00Z"}},
+		{Tags: map[string]string{periodStartLabel: "2024-10-01", periodEndLabel: "2024-11-01"}},
+		{Tags: map[string]string{"service": "S3"}},
+	}, now)
+	assert.Len(t, got, 3)
+	assert.Equal(t, time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC), got[0].Timestamp)
+	assert.Equal(t, tags, got[0].Tags)
+	assert.Equal(t, time.Date(2024, 10, 1, 11, 0, 0, 0, time.UTC), got[1].Timestamp)
+	// The current bucket ends in the future
+	assert.Equal(t, now, got[2].Timestamp)
+}
+
+// Backfilled series have to be the same as the live ones, so the history continues the live data
+func TestBackfillMatchesLiveSeries(t *testing.T) {
+	tm := testMetric
+	tm.Name = "daily"
+	acc := &account{
+		name:      "test",
+		namespace: defaultNamespace,
+		ce:        &fakeCostExplorer{},
+		queries:   []*MetricsConfig{&tm},
+		resolver:  newAccountResolver(OrganizationsConfig{}, nil),
+	}
+	live, err := acc.fetch(&tm)
+	assert.NoError(t, err)
+	st := store.New(store.Config{})
+	acc.put(st, &tm, live)
+	snapshot := st.Snapshot(defaultNamespace)
+	now := time.Now()
+	for i := range snapshot {
+		snapshot[i].Timestamp = now
+		if end, ok := snapshot[i].Period(periodEndLabel); ok && end.Before(now) {
+			snapshot[i].Timestamp = end
+		}
+	}
+	liveSeries := remotewrite.FromMetrics(snapshot)
+
+	var backfilled []intmetrics.Metric
+	err = acc.backfill(
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		func(metrics []intmetrics.Metric) error {
+			backfilled = append(backfilled, metrics...)
+			return nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, liveSeries, remotewrite.FromMetrics(backfilled))
+}
+
+func TestAccountBackfill(t *testing.T) {
+	ce := &fakeCostExplorer{}
+	tm := testMetric
+	tm.Name = "daily"
+	forecast := MetricsConfig{Name: "forecast", Type: queryTypeForecast, Granularity: "monthly"}
+	acc := &account{
+		name:     "test",
+		ce:       ce,
+		queries:  []*MetricsConfig{&tm, &forecast},
+		resolver: newAccountResolver(OrganizationsConfig{}, nil),
+	}
+	var written []intmetrics.Metric
+	err := acc.backfill(
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		func(metrics []intmetrics.Metric) error {
+			written = append(written, metrics...)
+			return nil
+		},
+	)
+	assert.NoError(t, err)
+	// One call per month, forecasts are skipped
+	assert.Equal(t, 2, ce.calls)
+	assert.NotEmpty(t, written)
+	for _, m := range written {
+		assert.False(t, m.Timestamp.IsZero())
+		assert.Contains(t, m.Tags, periodStartLabel)
+		assert.Equal(t, "daily", m.Tags["query"])
+	}
+}
@@ -0,0 +1,153 @@
+package clients
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+)
+
+// This file implements exponential backoff and a circuit breaker for the queries.
+// While the breaker is open, no calls are made and the last good data is served
+
+// Circuit breaker states. They are also the values of the state metric
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+
+	defaultInitialDelay     = 10 * time.Second
+	defaultMaxDelay         = 30 * time.Minute
+	defaultMultiplier       = 2.0
+	defaultJitter           = 0.2
+	defaultFailureThreshold = 3
+	defaultOpenTimeout      = 1 * time.Hour
+
+	breakerStateName = "cost_exporter_aws_circuit_breaker_state{job=\"cost-exporter\",account=%q,query=%q}"
+	nextRetryName    = "cost_exporter_aws_next_retry_timestamp_seconds{job=\"cost-exporter\",account=%q,query=%q}"
+)
+
+// RetryConfig configures the backoff between failed calls
+// and the circuit breaker of each query
+type RetryConfig struct {
+	InitialDelay time.Duration `mapstructure:"initial_delay,omitempty"`
+	MaxDelay     time.Duration `mapstructure:"max_delay,omitempty"`
+	Multiplier   float64       `mapstructure:"multiplier,omitempty"`
+	// Jitter is a fraction of the delay, which is randomly added or subtracted
+	Jitter float64 `mapstructure:"jitter,omitempty"`
+	// FailureThreshold is a number of consecutive failures that opens the breaker
+	FailureThreshold int `mapstructure:"failure_threshold,omitempty"`
+	// OpenTimeout is the time the breaker stays open before a probe call
+	OpenTimeout time.Duration `mapstructure:"open_timeout,omitempty"`
+}
+
+func (r RetryConfig) withDefaults() RetryConfig {
+	if r.InitialDelay <= 0 {
+		r.InitialDelay = defaultInitialDelay
+	}
+	if r.MaxDelay <= 0 {
+		r.MaxDelay = defaultMaxDelay
+	}
+	if r.Multiplier < 1 {
+		r.Multiplier = defaultMultiplier
+	}
+	if r.Jitter <= 0 || r.Jitter >= 1 {
+		r.Jitter = defaultJitter
+	}
+	if r.FailureThreshold <= 0 {
+		r.FailureThreshold = defaultFailureThreshold
+	}
+	if r.OpenTimeout <= 0 {
+		r.OpenTimeout = defaultOpenTimeout
+	}
+	return r
+}
+
+// backoff returns the delay before the next retry after the given number of failures
+func (r RetryConfig) backoff(failures int) time.Duration {
+	delay := float64(r.InitialDelay) * math.Pow(r.Multiplier, float64(max(failures-1, 0)))
+	delay = math.Min(delay, float64(r.MaxDelay))
+	delay += delay * r.Jitter * (2*rand.Float64() - 1) //nolint:gosec
+	return time.Duration(delay)
+}
+
+type breaker struct {
+	mu        sync.Mutex
+	retry     RetryConfig
+	state     int
+	failures  int
+	nextRetry time.Time
+}
+
+func newBreaker(accountName, query string, retry RetryConfig) *breaker {
+	b := &breaker{retry: retry.withDefaults()}
+	intmetrics.InternalMetricsSet.GetOrCreateGauge(fmt.Sprintf(breakerStateName, accountName, query), b.stateValue)
+	intmetrics.InternalMetricsSet.GetOrCreateGauge(fmt.Sprintf(nextRetryName, accountName, query), b.nextRetryValue)
+	return b
+}
+
+// allow reports whether a call can be made now.
+// An open breaker lets a single probe call through after the timeout
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerOpen {
+		return true
+	}
+	if now.Before(b.nextRetry) {
+		return false
+	}
+	b.state = breakerHalfOpen
+	return true
+}
+
+// openUntil returns the time, when the open breaker lets the probe call through.
+// It is zero if the breaker is not open
+func (b *breaker) openUntil() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerOpen {
+		return time.Time{}
+	}
+	return b.nextRetry
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.nextRetry = time.Time{}
+}
+
+// failure records a failed call and returns the time of the next attempt
+func (b *breaker) failure(now time.Time) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.retry.FailureThreshold {
+		b.state = breakerOpen
+		b.nextRetry = now.Add(b.retry.OpenTimeout)
+		return b.nextRetry
+	}
+	b.nextRetry = now.Add(b.retry.backoff(b.failures))
+	return b.nextRetry
+}
+
+func (b *breaker) stateValue() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return float64(b.state)
+}
+
+func (b *breaker) nextRetryValue() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.nextRetry.IsZero() {
+		return 0
+	}
+	return float64(b.nextRetry.Unix())
+}
@@ -0,0 +1,52 @@
+package clients
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	retry := RetryConfig{InitialDelay: 10 * time.Second, MaxDelay: time.Minute, Jitter: 0.1}.withDefaults()
+	for failures, expected := range map[int]time.Duration{
+		1: 10 * time.Second,
+		2: 20 * time.Second,
+		3: 40 * time.Second,
+		4: time.Minute,
+		9: time.Minute,
+	} {
+		got := retry.backoff(failures)
+		assert.InDelta(t, float64(expected), float64(got), float64(expected)*0.1)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2024, 10, 15, 0, 0, 0, 0, time.UTC)
+	b := newBreaker("test", "breaker_test", RetryConfig{FailureThreshold: 2, OpenTimeout: time.Hour})
+	assert.True(t, b.allow(now))
+
+	// The first failure is retried with backoff
+	next := b.failure(now)
+	assert.Less(t, next.Sub(now), time.Minute)
+	assert.InDelta(t, breakerClosed, b.stateValue(), 0)
+
+	// The threshold is reached, so the breaker opens
+	next = b.failure(now)
+	assert.Equal(t, now.Add(time.Hour), next)
+	assert.InDelta(t, breakerOpen, b.stateValue(), 0)
+	assert.InDelta(t, float64(next.Unix()), b.nextRetryValue(), 0)
+	assert.False(t, b.allow(now.Add(time.Minute)))
+
+	// A probe call is allowed after the timeout. If it fails, the breaker opens again
+	assert.True(t, b.allow(now.Add(time.Hour)))
+	assert.InDelta(t, breakerHalfOpen, b.stateValue(), 0)
+	next = b.failure(now.Add(time.Hour))
+	assert.Equal(t, now.Add(2*time.Hour), next)
+
+	// A successful probe closes the breaker
+	assert.True(t, b.allow(now.Add(2*time.Hour)))
+	b.success()
+	assert.InDelta(t, breakerClosed, b.stateValue(), 0)
+	assert.InDelta(t, 0, b.nextRetryValue(), 0)
+}
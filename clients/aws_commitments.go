@@ -0,0 +1,340 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+)
+
+// This file implements Reserved Instances and Savings Plans
+// utilization and coverage queries
+
+// commitmentLabels maps normalized Cost Explorer attributes to label names.
+// Other attributes, e.g. lease IDs or start times, are dropped to keep the cardinality sane
+var commitmentLabels = map[string]string{
+	"subscriptionid": "subscription_id",
+	"instancetype":   "instance_type",
+	"instancefamily": "instance_family",
+	"region":         "region",
+	"accountid":      "linked_account",
+	"linkedaccount":  "linked_account",
+	"platform":       "platform",
+	"service":        "service",
+}
+
+// commitmentPeriod returns the time period and the granularity of the RI or SP query.
+// Only daily and monthly granularities are supported. Granularity is optional,
+// the results are aggregated over the whole period then.
+// Cost Explorer rejects the granularity together with group_by,
+// so it is only used for the default lookback of the grouped queries
+func commitmentPeriod(metric *MetricsConfig, grouped bool) (*types.DateInterval, types.Granularity, error) {
+	granularity := strings.ToLower(metric.Granularity)
+	switch granularity {
+	case "daily", "monthly":
+	case "":
+		// Dates are required either way
+		granularity = "daily"
+	default:
+		return nil, "", fmt.Errorf("%w: %s. Supported: daily, monthly", ErrGranularity, metric.Granularity)
+	}
+	period, err := metric.Window.resolve(time.Now().UTC(), granularity)
+	if err != nil {
+		return nil, "", err
+	}
+	if grouped || metric.Granularity == "" {
+		return period, "", nil
+	}
+	return period, types.Granularity(strings.ToUpper(granularity)), nil
+}
+
+func buildReservationUtilizationInput(metric *MetricsConfig) (*costexplorer.GetReservationUtilizationInput, error) {
+	period, granularity, err := commitmentPeriod(metric, len(metric.GroupBy) > 0)
+	if err != nil {
+		return nil, err
+	}
+	ceInput := &costexplorer.GetReservationUtilizationInput{
+		TimePeriod:  period,
+		Granularity: granularity,
+		GroupBy:     metric.GroupBy,
+	}
+	if !isZeroExpression(metric.Filter) {
+		ceInput.Filter = &metric.Filter
+	}
+	return ceInput, nil
+}
+
+func buildReservationCoverageInput(metric *MetricsConfig) (*costexplorer.GetReservationCoverageInput, error) {
+	period, granularity, err := commitmentPeriod(metric, len(metric.GroupBy) > 0)
+	if err != nil {
+		return nil, err
+	}
+	ceInput := &costexplorer.GetReservationCoverageInput{
+		TimePeriod:  period,
+		Granularity: granularity,
+		GroupBy:     metric.GroupBy,
+	}
+	if !isZeroExpression(metric.Filter) {
+		ceInput.Filter = &metric.Filter
+	}
+	return ceInput, nil
+}
+
+// GetSavingsPlansUtilization cannot be grouped
+func buildSavingsPlansUtilizationInput(metric *MetricsConfig) (*costexplorer.GetSavingsPlansUtilizationInput, error) {
+	period, granularity, err := commitmentPeriod(metric, false)
+	if err != nil {
+		return nil, err
+	}
+	ceInput := &costexplorer.GetSavingsPlansUtilizationInput{
+		TimePeriod:  period,
+		Granularity: granularity,
+	}
+	if !isZeroExpression(metric.Filter) {
+		ceInput.Filter = &metric.Filter
+	}
+	return ceInput, nil
+}
+
+func buildSavingsPlansCoverageInput(metric *MetricsConfig) (*costexplorer.GetSavingsPlansCoverageInput, error) {
+	period, granularity, err := commitmentPeriod(metric, len(metric.GroupBy) > 0)
+	if err != nil {
+		return nil, err
+	}
+	ceInput := &costexplorer.GetSavingsPlansCoverageInput{
+		TimePeriod:  period,
+		Granularity: granularity,
+		GroupBy:     metric.GroupBy,
+	}
+	if !isZeroExpression(metric.Filter) {
+		ceInput.Filter = &metric.Filter
+	}
+	return ceInput, nil
+}
+
+// commitmentCosts are the RI and SP amounts in the billing currency
+var commitmentCosts = map[string]bool{
+	"ReservationNetSavings":        true,
+	"ReservationAmortizedFee":      true,
+	"ReservationOnDemandCost":      true,
+	"SavingsPlansTotalCommitment":  true,
+	"SavingsPlansUsedCommitment":   true,
+	"SavingsPlansUnusedCommitment": true,
+	"SavingsPlansCoveredSpend":     true,
+	"SavingsPlansOnDemandCost":     true,
+	"SavingsPlansTotalCost":        true,
+}
+
+func (a *account) fetchReservationUtilization(metric *MetricsConfig) ([]intmetrics.Metric, error) {
+	ceInput, err := buildReservationUtilizationInput(metric)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []intmetrics.Metric{}
+	for {
+		out, err := a.ce.GetReservationUtilization(context.TODO(), ceInput)
+		if err := countCall(out == nil, err); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, convertReservationUtilization(out, a.billingCurrency)...)
+		if out.NextPageToken == nil {
+			break
+		}
+		ceInput.NextPageToken = out.NextPageToken
+	}
+	return metrics, nil
+}
+
+func (a *account) fetchReservationCoverage(metric *MetricsConfig) ([]intmetrics.Metric, error) {
+	ceInput, err := buildReservationCoverageInput(metric)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []intmetrics.Metric{}
+	for {
+		out, err := a.ce.GetReservationCoverage(context.TODO(), ceInput)
+		if err := countCall(out == nil, err); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, convertReservationCoverage(out, a.billingCurrency)...)
+		if out.NextPageToken == nil {
+			break
+		}
+		ceInput.NextPageToken = out.NextPageToken
+	}
+	return metrics, nil
+}
+
+func (a *account) fetchSavingsPlansUtilization(metric *MetricsConfig) ([]intmetrics.Metric, error) {
+	ceInput, err := buildSavingsPlansUtilizationInput(metric)
+	if err != nil {
+		return nil, err
+	}
+	// GetSavingsPlansUtilization is not paginated
+	out, err := a.ce.GetSavingsPlansUtilization(context.TODO(), ceInput)
+	if err := countCall(out == nil, err); err != nil {
+		return nil, err
+	}
+	return convertSavingsPlansUtilization(out, a.billingCurrency), nil
+}
+
+func (a *account) fetchSavingsPlansCoverage(metric *MetricsConfig) ([]intmetrics.Metric, error) {
+	ceInput, err := buildSavingsPlansCoverageInput(metric)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []intmetrics.Metric{}
+	for {
+		out, err := a.ce.GetSavingsPlansCoverage(context.TODO(), ceInput)
+		if err := countCall(out == nil, err); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, convertSavingsPlansCoverage(out, a.billingCurrency)...)
+		if out.NextToken == nil {
+			break
+		}
+		ceInput.NextToken = out.NextToken
+	}
+	return metrics, nil
+}
+
+func convertReservationUtilization(out *costexplorer.GetReservationUtilizationOutput, currency string) []intmetrics.Metric {
+	metrics := []intmetrics.Metric{}
+	for _, u := range out.UtilizationsByTime {
+		tags := periodTags(u.TimePeriod)
+		// Results are not grouped if GroupBy is not set. Only totals are available then
+		if len(u.Groups) == 0 {
+			metrics = append(metrics, convertAmounts(reservationAggregates(u.Total), currency, tags)...)
+			continue
+		}
+		for _, g := range u.Groups {
+			groupTags := commitmentTags(tags, g.Attributes)
+			if g.Key != nil && g.Value != nil {
+				maps.Copy(groupTags, commitmentTags(nil, map[string]string{*g.Key: *g.Value}))
+			}
+			metrics = append(metrics, convertAmounts(reservationAggregates(g.Utilization), currency, groupTags)...)
+		}
+	}
+	return metrics
+}
+
+func convertReservationCoverage(out *costexplorer.GetReservationCoverageOutput, currency string) []intmetrics.Metric {
+	metrics := []intmetrics.Metric{}
+	for _, c := range out.CoveragesByTime {
+		tags := periodTags(c.TimePeriod)
+		if len(c.Groups) == 0 {
+			metrics = append(metrics, convertAmounts(reservationCoverage(c.Total), currency, tags)...)
+			continue
+		}
+		for _, g := range c.Groups {
+			metrics = append(metrics, convertAmounts(reservationCoverage(g.Coverage), currency, commitmentTags(tags, g.Attributes))...)
+		}
+	}
+	return metrics
+}
+
+func convertSavingsPlansUtilization(out *costexplorer.GetSavingsPlansUtilizationOutput, currency string) []intmetrics.Metric {
+	metrics := []intmetrics.Metric{}
+	for _, u := range out.SavingsPlansUtilizationsByTime {
+		if u.Utilization == nil {
+			continue
+		}
+		values := map[string]*string{
+			"SavingsPlansUtilizationPercentage": u.Utilization.UtilizationPercentage,
+			"SavingsPlansTotalCommitment":       u.Utilization.TotalCommitment,
+			"SavingsPlansUsedCommitment":        u.Utilization.UsedCommitment,
+			"SavingsPlansUnusedCommitment":      u.Utilization.UnusedCommitment,
+		}
+		metrics = append(metrics, convertAmounts(values, currency, periodTags(u.TimePeriod))...)
+	}
+	return metrics
+}
+
+func convertSavingsPlansCoverage(out *costexplorer.GetSavingsPlansCoverageOutput, currency string) []intmetrics.Metric {
+	metrics := []intmetrics.Metric{}
+	for _, c := range out.SavingsPlansCoverages {
+		if c.Coverage == nil {
+			continue
+		}
+		values := map[string]*string{
+			"SavingsPlansCoveragePercentage": c.Coverage.CoveragePercentage,
+			"SavingsPlansCoveredSpend":       c.Coverage.SpendCoveredBySavingsPlans,
+			"SavingsPlansOnDemandCost":       c.Coverage.OnDemandCost,
+			"SavingsPlansTotalCost":          c.Coverage.TotalCost,
+		}
+		metrics = append(metrics, convertAmounts(values, currency, commitmentTags(periodTags(c.TimePeriod), c.Attributes))...)
+	}
+	return metrics
+}
+
+func reservationAggregates(u *types.ReservationAggregates) map[string]*string {
+	if u == nil {
+		return nil
+	}
+	return map[string]*string{
+		"ReservationUtilizationPercentage": u.UtilizationPercentage,
+		"ReservationPurchasedHours":        u.PurchasedHours,
+		"ReservationUsedHours":             u.TotalActualHours,
+		"ReservationUnusedHours":           u.UnusedHours,
+		"ReservationNetSavings":            u.NetRISavings,
+		"ReservationAmortizedFee":          u.TotalAmortizedFee,
+	}
+}
+
+func reservationCoverage(c *types.Coverage) map[string]*string {
+	if c == nil {
+		return nil
+	}
+	values := map[string]*string{}
+	if c.CoverageHours != nil {
+		values["ReservationCoveragePercentage"] = c.CoverageHours.CoverageHoursPercentage
+		values["ReservationCoveredHours"] = c.CoverageHours.ReservedHours
+		values["ReservationOnDemandHours"] = c.CoverageHours.OnDemandHours
+		values["ReservationTotalRunningHours"] = c.CoverageHours.TotalRunningHours
+	}
+	if c.CoverageCost != nil {
+		values["ReservationOnDemandCost"] = c.CoverageCost.OnDemandCost
+	}
+	return values
+}
+
+// convertAmounts converts a set of named amounts into the internal format.
+// Cost Explorer returns no units here, so the costs get the billing currency
+func convertAmounts(values map[string]*string, currency string, tags map[string]string) []intmetrics.Metric {
+	metricValues := map[string]types.MetricValue{}
+	for name, amount := range values {
+		value := types.MetricValue{Amount: amount}
+		if commitmentCosts[name] {
+			value.Unit = aws.String(currency)
+		}
+		metricValues[name] = value
+	}
+	return convertMetricValues(metricValues, tags)
+}
+
+// commitmentTags adds the known Cost Explorer attributes to the tags.
+// Attribute names come in different cases, e.g. `instanceType` or `INSTANCE_TYPE`
+func commitmentTags(tags map[string]string, attributes map[string]string) map[string]string {
+	res := maps.Clone(tags)
+	if res == nil {
+		res = map[string]string{}
+	}
+	for k, v := range attributes {
+		if label, ok := commitmentLabels[strings.ToLower(strings.ReplaceAll(k, "_", ""))]; ok {
+			res[label] = v
+		}
+	}
+	// Instance family is not always present, but it can be derived from the instance type
+	if _, ok := res["instance_family"]; !ok {
+		if family, _, found := strings.Cut(res["instance_type"], "."); found {
+			res["instance_family"] = family
+		}
+	}
+	return res
+}
@@ -0,0 +1,147 @@
+package clients
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitmentTags(t *testing.T) {
+	got := commitmentTags(map[string]string{"period_start": "2024-10-01"}, map[string]string{
+		"subscriptionId": "123",
+		"instanceType":   "m5.large",
+		"region":         "us-east-1",
+		"leaseId":        "abc",
+	})
+	assert.Equal(t, map[string]string{
+		"period_start":    "2024-10-01",
+		"subscription_id": "123",
+		"instance_type":   "m5.large",
+		"instance_family": "m5",
+		"region":          "us-east-1",
+	}, got)
+}
+
+func TestConvertReservationUtilization(t *testing.T) {
+	out := costexplorer.GetReservationUtilizationOutput{
+		UtilizationsByTime: []types.UtilizationByTime{
+			{
+				TimePeriod: &types.DateInterval{Start: aws.String("2024-10-01"), End: aws.String("2024-10-02")},
+				Groups: []types.ReservationUtilizationGroup{
+					{
+						Key:        aws.String("SUBSCRIPTION_ID"),
+						Value:      aws.String("123"),
+						Attributes: map[string]string{"instanceType": "m5.large", "region": "us-east-1"},
+						Utilization: &types.ReservationAggregates{
+							UtilizationPercentage: aws.String("87.5"),
+						},
+					},
+				},
+			},
+		},
+	}
+	got := convertReservationUtilization(&out, "USD")
+	assert.Len(t, got, 1)
+	assert.Equal(t, "ReservationUtilizationPercentage", got[0].Name)
+	assert.InDelta(t, 87.5, got[0].Value, 0.0001)
+	assert.Equal(t, "123", got[0].Tags["subscription_id"])
+	assert.Equal(t, "m5", got[0].Tags["instance_family"])
+	assert.Equal(t, "us-east-1", got[0].Tags["region"])
+}
+
+func TestConvertSavingsPlansCoverage(t *testing.T) {
+	out := costexplorer.GetSavingsPlansCoverageOutput{
+		SavingsPlansCoverages: []types.SavingsPlansCoverage{
+			{
+				TimePeriod: &types.DateInterval{Start: aws.String("2024-10-01"), End: aws.String("2024-10-02")},
+				Attributes: map[string]string{"INSTANCE_FAMILY": "c6g", "REGION": "eu-west-1"},
+				Coverage: &types.SavingsPlansCoverageData{
+					CoveragePercentage: aws.String("60"),
+					OnDemandCost:       aws.String("40"),
+				},
+			},
+		},
+	}
+	got := convertSavingsPlansCoverage(&out, "USD")
+	assert.Len(t, got, 2)
+	for _, m := range got {
+		assert.Equal(t, "c6g", m.Tags["instance_family"])
+		assert.Equal(t, "eu-west-1", m.Tags["region"])
+	}
+}
+
+func TestConvertSavingsPlansUtilizationCurrency(t *testing.T) {
+	out := costexplorer.GetSavingsPlansUtilizationOutput{
+		SavingsPlansUtilizationsByTime: []types.SavingsPlansUtilizationByTime{
+			{
+				TimePeriod: &types.DateInterval{Start: aws.String("2024-10-01"), End: aws.String("2024-10-02")},
+				Utilization: &types.SavingsPlansUtilization{
+					TotalCommitment:       aws.String("100"),
+					UtilizationPercentage: aws.String("90"),
+				},
+			},
+		},
+	}
+	// An account billed in EUR reported in USD
+	got := convertSavingsPlansUtilization(&out, "EUR")
+	newCurrencyConverter(CurrencyConfig{Reporting: "usd", Rates: map[string]float64{"eur": 1.08}}).normalize(got)
+	values := map[string]intmetrics.Metric{}
+	for _, m := range got {
+		values[m.Name] = m
+	}
+	assert.InDelta(t, 108.0, values["SavingsPlansTotalCommitment"].Value, 0.0001)
+	assert.Equal(t, "USD", values["SavingsPlansTotalCommitment"].Tags[currencyLabel])
+	// Percentages are not converted
+	assert.InDelta(t, 90.0, values["SavingsPlansUtilizationPercentage"].Value, 0.0001)
+	assert.NotContains(t, values["SavingsPlansUtilizationPercentage"].Tags, currencyLabel)
+}
+
+func TestBuildReservationUtilizationInput(t *testing.T) {
+	grouped := MetricsConfig{
+		Type:        queryTypeReservationUtilization,
+		Granularity: "daily",
+		Window:      WindowConfig{Start: "2024-10-01", End: "2024-10-08"},
+		GroupBy:     []types.GroupDefinition{{Key: aws.String("SUBSCRIPTION_ID"), Type: types.GroupDefinitionTypeDimension}},
+	}
+	got, err := buildReservationUtilizationInput(&grouped)
+	assert.NoError(t, err)
+	// Cost Explorer rejects the granularity together with group by
+	assert.Equal(t, &costexplorer.GetReservationUtilizationInput{
+		TimePeriod: &types.DateInterval{Start: aws.String("2024-10-01"), End: aws.String("2024-10-08")},
+		GroupBy:    grouped.GroupBy,
+	}, got)
+
+	totals := grouped
+	totals.GroupBy = nil
+	got, err = buildReservationUtilizationInput(&totals)
+	assert.NoError(t, err)
+	assert.Equal(t, types.GranularityDaily, got.Granularity)
+}
+
+func TestBuildSavingsPlansCoverageInputDefaultLookback(t *testing.T) {
+	metric := MetricsConfig{
+		Type:    queryTypeSavingsPlansCoverage,
+		GroupBy: []types.GroupDefinition{{Key: aws.String("INSTANCE_FAMILY"), Type: types.GroupDefinitionTypeDimension}},
+	}
+	got, err := buildSavingsPlansCoverageInput(&metric)
+	assert.NoError(t, err)
+	assert.Empty(t, got.Granularity)
+	assert.Equal(t, time.Now().UTC().Format("2006-01-02"), *got.TimePeriod.End)
+}
+
+func TestValidateCommitmentGranularity(t *testing.T) {
+	for _, queryType := range []string{
+		queryTypeReservationUtilization, queryTypeReservationCoverage,
+		queryTypeSavingsPlansUtilization, queryTypeSavingsPlansCoverage,
+	} {
+		metric := MetricsConfig{Type: queryType, Granularity: "hourly"}
+		assert.ErrorIs(t, metric.validate(), ErrGranularity)
+		metric.Granularity = "monthly"
+		assert.NoError(t, metric.validate())
+	}
+}
@@ -0,0 +1,119 @@
+package clients
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/ettle/strcase"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/logger"
+)
+
+const (
+	forecastPrefix       = "Forecast"
+	forecastBoundLabel   = "forecast_bound"
+	forecastBoundMean    = "mean"
+	forecastBoundLower   = "lower"
+	forecastBoundUpper   = "upper"
+	defaultForecastLevel = 80 // AWS default prediction interval level
+)
+
+// fetchForecast gets the forecast until the end of the current month.
+// GetCostForecast accepts a single metric, so there is one call per metric
+func (a *account) fetchForecast(metric *MetricsConfig) ([]intmetrics.Metric, error) {
+	ceInputs, err := buildCostForecastInputs(metric)
+	if err != nil {
+		return nil, err
+	}
+	metrics := []intmetrics.Metric{}
+	for i, ceInput := range ceInputs {
+		out, err := a.ce.GetCostForecast(context.TODO(), ceInput)
+		if err := countCall(out == nil, err); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, convertForecast(metric.Metrics[i], out)...)
+	}
+	return metrics, nil
+}
+
+// buildCostForecastInputs returns an input for each configured metric.
+// Forecast starts today and ends on the first day of the next month
+func buildCostForecastInputs(metric *MetricsConfig) ([]*costexplorer.GetCostForecastInput, error) {
+	granularity := strings.ToUpper(metric.Granularity)
+	switch granularity {
+	case "":
+		granularity = string(types.GranularityMonthly)
+	case string(types.GranularityMonthly), string(types.GranularityDaily):
+	default:
+		logger.Errorf("unsupported forecast granularity: %s. Supported: monthly, daily", metric.Granularity)
+		return nil, ErrGranularity
+	}
+
+	level := metric.PredictionIntervalLevel
+	if level == 0 {
+		level = defaultForecastLevel
+	}
+
+	nowUtc := time.Now().UTC()
+	start := nowUtc.Format("2006-01-02")
+	end := time.Date(nowUtc.Year(), nowUtc.Month()+1, 1, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+
+	inputs := []*costexplorer.GetCostForecastInput{}
+	for _, m := range metric.Metrics {
+		in := &costexplorer.GetCostForecastInput{
+			TimePeriod: &types.DateInterval{
+				Start: aws.String(start),
+				End:   aws.String(end),
+			},
+			Granularity:             types.Granularity(granularity),
+			Metric:                  forecastMetric(m),
+			PredictionIntervalLevel: aws.Int32(level),
+		}
+		// Filters cannot be empty when making a query
+		if !isZeroExpression(metric.Filter) {
+			in.Filter = &metric.Filter
+		}
+		inputs = append(inputs, in)
+	}
+	return inputs, nil
+}
+
+// forecastMetric converts the metric name used by GetCostAndUsage,
+// e.g. NetUnblendedCost, into the one used by GetCostForecast: NET_UNBLENDED_COST
+func forecastMetric(name string) types.Metric {
+	return types.Metric(strcase.ToSNAKE(name))
+}
+
+// convertForecast converts the forecast into the internal format.
+// Each forecast bucket produces the mean value and the prediction interval bounds
+func convertForecast(name string, out *costexplorer.GetCostForecastOutput) []intmetrics.Metric {
+	metrics := []intmetrics.Metric{}
+	// Only the total has the unit. It's the same for all the buckets
+	var unit *string
+	if out.Total != nil {
+		unit = out.Total.Unit
+	}
+	for _, r := range out.ForecastResultsByTime {
+		bounds := map[string]*string{
+			forecastBoundMean:  r.MeanValue,
+			forecastBoundLower: r.PredictionIntervalLowerBound,
+			forecastBoundUpper: r.PredictionIntervalUpperBound,
+		}
+		for bound, amount := range bounds {
+			if amount == nil {
+				continue
+			}
+			tags := periodTags(r.TimePeriod)
+			tags[forecastBoundLabel] = bound
+			metrics = append(metrics, convertMetricValues(
+				map[string]types.MetricValue{forecastPrefix + name: {Amount: amount, Unit: unit}},
+				tags,
+			)...)
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,62 @@
+package clients
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForecastMetric(t *testing.T) {
+	assert.Equal(t, types.MetricNetUnblendedCost, forecastMetric("NetUnblendedCost"))
+	assert.Equal(t, types.MetricUnblendedCost, forecastMetric("UNBLENDED_COST"))
+}
+
+func TestBuildCostForecastInputs(t *testing.T) {
+	m := MetricsConfig{
+		Type:    queryTypeForecast,
+		Metrics: []string{"NetUnblendedCost", "NetAmortizedCost"},
+	}
+	got, err := buildCostForecastInputs(&m)
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	nowUtc := time.Now().UTC()
+	assert.Equal(t, nowUtc.Format("2006-01-02"), *got[0].TimePeriod.Start)
+	end, err := time.Parse("2006-01-02", *got[0].TimePeriod.End)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, end.Day())
+	assert.Equal(t, types.GranularityMonthly, got[0].Granularity)
+	assert.Equal(t, int32(defaultForecastLevel), *got[0].PredictionIntervalLevel)
+	assert.Nil(t, got[0].Filter)
+	assert.Equal(t, types.MetricNetAmortizedCost, got[1].Metric)
+}
+
+func TestBuildCostForecastInputsGranularity(t *testing.T) {
+	m := MetricsConfig{Type: queryTypeForecast, Granularity: "hourly", Metrics: []string{"UnblendedCost"}}
+	_, err := buildCostForecastInputs(&m)
+	assert.ErrorIs(t, err, ErrGranularity)
+}
+
+func TestConvertForecast(t *testing.T) {
+	out := costexplorer.GetCostForecastOutput{
+		ForecastResultsByTime: []types.ForecastResult{
+			{
+				MeanValue:                    aws.String("100"),
+				PredictionIntervalLowerBound: aws.String("90"),
+				PredictionIntervalUpperBound: aws.String("110"),
+				TimePeriod:                   &types.DateInterval{Start: aws.String("2024-10-15"), End: aws.String("2024-11-01")},
+			},
+		},
+	}
+	got := convertForecast("NetUnblendedCost", &out)
+	assert.Len(t, got, 3)
+	values := map[string]float64{}
+	for _, m := range got {
+		assert.Equal(t, "ForecastNetUnblendedCost", m.Name)
+		values[m.Tags[forecastBoundLabel]] = m.Value
+	}
+	assert.Equal(t, map[string]float64{"mean": 100, "lower": 90, "upper": 110}, values)
+}
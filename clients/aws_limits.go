@@ -0,0 +1,207 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+)
+
+// This file implements the request rate limiter
+// and the monthly budget of Cost Explorer API calls.
+// See: https://aws.amazon.com/aws-cost-management/aws-cost-explorer/pricing/
+
+const (
+	defaultCostPerCall = 0.01 // USD
+
+	apiCallsMonthName      = "cost_exporter_aws_api_calls_month{job=\"cost-exporter\"}"
+	apiCostName            = "cost_exporter_aws_api_cost_usd{job=\"cost-exporter\"}"
+	apiCostProjectedName   = "cost_exporter_aws_api_cost_projected_usd{job=\"cost-exporter\"}"
+	apiBudgetExhaustedName = "cost_exporter_aws_api_budget_exhausted{job=\"cost-exporter\"}"
+	dataStaleName          = "cost_exporter_aws_data_stale{job=\"cost-exporter\",account=%q,query=%q}"
+)
+
+var ErrBudgetExceeded = errors.New("monthly Cost Explorer API call budget is exceeded")
+
+// LimitsConfig limits the Cost Explorer API usage across all accounts.
+// Zero values mean no limits
+type LimitsConfig struct {
+	RequestsPerMinute int `mapstructure:"requests_per_minute,omitempty"`
+	// MonthlyCallBudget is a maximum number of calls per calendar month.
+	// The counter is kept in memory, so it is reset on restart
+	MonthlyCallBudget int     `mapstructure:"monthly_call_budget,omitempty"`
+	CostPerCall       float64 `mapstructure:"cost_per_call,omitempty"`
+}
+
+type limiter struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	budget      int
+	costPerCall float64
+	next        time.Time
+	monthStart  time.Time
+	monthCalls  int
+	now         func() time.Time
+}
+
+func newLimiter(cfg LimitsConfig) *limiter {
+	l := &limiter{
+		budget:      cfg.MonthlyCallBudget,
+		costPerCall: cfg.CostPerCall,
+		now:         time.Now,
+	}
+	if cfg.RequestsPerMinute > 0 {
+		l.interval = time.Minute / time.Duration(cfg.RequestsPerMinute)
+	}
+	if l.costPerCall <= 0 {
+		l.costPerCall = defaultCostPerCall
+	}
+	l.monthStart = monthStart(l.now())
+	return l
+}
+
+// registerMetrics exposes the API usage next to the AWS calls metrics
+func (l *limiter) registerMetrics() {
+	intmetrics.InternalMetricsSet.GetOrCreateGauge(apiCallsMonthName, func() float64 {
+		calls, _ := l.usage()
+		return float64(calls)
+	})
+	intmetrics.InternalMetricsSet.GetOrCreateGauge(apiCostName, func() float64 {
+		calls, _ := l.usage()
+		return float64(calls) * l.costPerCall
+	})
+	intmetrics.InternalMetricsSet.GetOrCreateGauge(apiCostProjectedName, l.projectedCost)
+	intmetrics.InternalMetricsSet.GetOrCreateGauge(apiBudgetExhaustedName, func() float64 {
+		calls, _ := l.usage()
+		if l.budget > 0 && calls >= l.budget {
+			return 1
+		}
+		return 0
+	})
+}
+
+// acquire blocks until a call is allowed by the rate limit.
+// It returns an error if the monthly budget is exceeded
+func (l *limiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	now := l.now()
+	l.rollMonth(now)
+	if l.budget > 0 && l.monthCalls >= l.budget {
+		l.mu.Unlock()
+		return ErrBudgetExceeded
+	}
+	// Each request is paid, even if it fails, so it's counted before the call
+	l.monthCalls++
+	var wait time.Duration
+	if l.interval > 0 {
+		if l.next.After(now) {
+			wait = l.next.Sub(now)
+			l.next = l.next.Add(l.interval)
+		} else {
+			l.next = now.Add(l.interval)
+		}
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// usage returns the number of calls in the current month and the month start
+func (l *limiter) usage() (int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollMonth(l.now())
+	return l.monthCalls, l.monthStart
+}
+
+// projectedCost extrapolates the API cost of the current month
+// based on the number of calls made so far
+func (l *limiter) projectedCost() float64 {
+	calls, start := l.usage()
+	elapsed := l.now().Sub(start)
+	if elapsed <= 0 {
+		return 0
+	}
+	month := start.AddDate(0, 1, 0).Sub(start)
+	return float64(calls) * l.costPerCall * float64(month) / float64(elapsed)
+}
+
+func (l *limiter) rollMonth(now time.Time) {
+	if start := monthStart(now); start.After(l.monthStart) {
+		l.monthStart = start
+		l.monthCalls = 0
+	}
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// limitedCostExplorer applies the limits to each Cost Explorer call
+type limitedCostExplorer struct {
+	ce      costExplorerAPI
+	limiter *limiter
+}
+
+func limited[Out any](ctx context.Context, l *limiter, call func() (*Out, error)) (*Out, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	return call()
+}
+
+func (c *limitedCostExplorer) GetCostAndUsage(ctx context.Context, in *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	return limited(ctx, c.limiter, func() (*costexplorer.GetCostAndUsageOutput, error) {
+		return c.ce.GetCostAndUsage(ctx, in, optFns...)
+	})
+}
+
+func (c *limitedCostExplorer) GetCostForecast(ctx context.Context, in *costexplorer.GetCostForecastInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostForecastOutput, error) {
+	return limited(ctx, c.limiter, func() (*costexplorer.GetCostForecastOutput, error) {
+		return c.ce.GetCostForecast(ctx, in, optFns...)
+	})
+}
+
+func (c *limitedCostExplorer) GetReservationUtilization(ctx context.Context, in *costexplorer.GetReservationUtilizationInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetReservationUtilizationOutput, error) {
+	return limited(ctx, c.limiter, func() (*costexplorer.GetReservationUtilizationOutput, error) {
+		return c.ce.GetReservationUtilization(ctx, in, optFns...)
+	})
+}
+
+func (c *limitedCostExplorer) GetReservationCoverage(ctx context.Context, in *costexplorer.GetReservationCoverageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetReservationCoverageOutput, error) {
+	return limited(ctx, c.limiter, func() (*costexplorer.GetReservationCoverageOutput, error) {
+		return c.ce.GetReservationCoverage(ctx, in, optFns...)
+	})
+}
+
+func (c *limitedCostExplorer) GetSavingsPlansUtilization(ctx context.Context, in *costexplorer.GetSavingsPlansUtilizationInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetSavingsPlansUtilizationOutput, error) {
+	return limited(ctx, c.limiter, func() (*costexplorer.GetSavingsPlansUtilizationOutput, error) {
+		return c.ce.GetSavingsPlansUtilization(ctx, in, optFns...)
+	})
+}
+
+func (c *limitedCostExplorer) GetSavingsPlansCoverage(ctx context.Context, in *costexplorer.GetSavingsPlansCoverageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetSavingsPlansCoverageOutput, error) {
+	return limited(ctx, c.limiter, func() (*costexplorer.GetSavingsPlansCoverageOutput, error) {
+		return c.ce.GetSavingsPlansCoverage(ctx, in, optFns...)
+	})
+}
+
+func (c *limitedCostExplorer) GetAnomalies(ctx context.Context, in *costexplorer.GetAnomaliesInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetAnomaliesOutput, error) {
+	return limited(ctx, c.limiter, func() (*costexplorer.GetAnomaliesOutput, error) {
+		return c.ce.GetAnomalies(ctx, in, optFns...)
+	})
+}
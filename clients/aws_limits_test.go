@@ -0,0 +1,46 @@
+package clients
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterBudget(t *testing.T) {
+	now := time.Date(2024, 10, 31, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(LimitsConfig{MonthlyCallBudget: 2})
+	l.now = func() time.Time { return now }
+	l.monthStart = monthStart(now)
+
+	assert.NoError(t, l.acquire(context.Background()))
+	assert.NoError(t, l.acquire(context.Background()))
+	assert.ErrorIs(t, l.acquire(context.Background()), ErrBudgetExceeded)
+
+	// The budget is reset in the next month
+	now = now.Add(24 * time.Hour)
+	assert.NoError(t, l.acquire(context.Background()))
+	calls, start := l.usage()
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), start)
+}
+
+func TestLimiterRate(t *testing.T) {
+	l := newLimiter(LimitsConfig{RequestsPerMinute: 6000}) // 10ms between requests
+	startTs := time.Now()
+	for range 3 {
+		assert.NoError(t, l.acquire(context.Background()))
+	}
+	assert.GreaterOrEqual(t, time.Since(startTs), 20*time.Millisecond)
+}
+
+func TestLimiterProjectedCost(t *testing.T) {
+	// 10 calls in the first 3 days of a 30-day month
+	now := time.Date(2024, 11, 4, 0, 0, 0, 0, time.UTC)
+	l := newLimiter(LimitsConfig{})
+	l.now = func() time.Time { return now }
+	l.monthStart = monthStart(now)
+	l.monthCalls = 10
+	assert.InDelta(t, 1.0, l.projectedCost(), 0.0001)
+}
@@ -0,0 +1,196 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/logger"
+)
+
+// This file implements resolution of linked account IDs
+// to account names and organizational units
+
+const (
+	defaultOrganizationsRefresh = 24 * time.Hour
+	linkedAccountLabel          = "linked_account"
+	accountNameLabel            = "account_name"
+	ouLabel                     = "ou"
+	rootOU                      = "root"
+)
+
+// OrganizationsConfig configures the account names resolution.
+// If enabled, account names and OUs are fetched from AWS Organizations.
+// Static accounts are used as a fallback, e.g. without Organizations access.
+// Account IDs in the static mapping must be quoted in YAML
+type OrganizationsConfig struct {
+	Enabled         bool                   `mapstructure:"enabled,omitempty"`
+	Role            string                 `mapstructure:"role,omitempty"`
+	ExternalID      string                 `mapstructure:"external_id,omitempty"`
+	RefreshInterval time.Duration          `mapstructure:"refresh_interval,omitempty"`
+	Accounts        map[string]AccountInfo `mapstructure:"accounts,omitempty"`
+}
+
+// AccountInfo is a name and an organizational unit of a linked account
+type AccountInfo struct {
+	Name string `mapstructure:"name"`
+	OU   string `mapstructure:"ou,omitempty"`
+}
+
+// organizationsAPI is a subset of the Organizations client used by the exporter
+type organizationsAPI interface {
+	organizations.ListAccountsAPIClient
+	ListParents(context.Context, *organizations.ListParentsInput, ...func(*organizations.Options)) (*organizations.ListParentsOutput, error)
+	DescribeOrganizationalUnit(context.Context, *organizations.DescribeOrganizationalUnitInput, ...func(*organizations.Options)) (*organizations.DescribeOrganizationalUnitOutput, error)
+}
+
+type accountResolver struct {
+	mu       sync.RWMutex
+	org      organizationsAPI // nil if Organizations are disabled
+	interval time.Duration
+	static   map[string]AccountInfo
+	accounts map[string]AccountInfo
+}
+
+func newAccountResolver(cfg OrganizationsConfig, org organizationsAPI) *accountResolver {
+	interval := cfg.RefreshInterval
+	if interval <= 0 {
+		interval = defaultOrganizationsRefresh
+	}
+	return &accountResolver{
+		org:      org,
+		interval: interval,
+		static:   cfg.Accounts,
+		accounts: map[string]AccountInfo{},
+	}
+}
+
+// newOrganizationsClient returns nil if Organizations are disabled
+func newOrganizationsClient(cfg *AWSConfig, base aws.Config) organizationsAPI {
+	if !cfg.Organizations.Enabled || strings.EqualFold(cfg.Mode, modeReplay) {
+		return nil
+	}
+	orgCfg := accountAWSConfig(base, &AccountConfig{
+		Name:       "organizations",
+		AssumeRole: cfg.Organizations.Role,
+		ExternalID: cfg.Organizations.ExternalID,
+	})
+	return organizations.NewFromConfig(orgCfg)
+}
+
+// run refreshes the accounts on a slow schedule.
+// The first refresh is done by update before the metrics are fetched
+func (r *accountResolver) run() {
+	if r.org == nil {
+		return
+	}
+	for {
+		time.Sleep(r.interval)
+		r.update()
+	}
+}
+
+// update refreshes the accounts if AWS Organizations is enabled.
+// Failed refreshes keep the previously fetched accounts
+func (r *accountResolver) update() {
+	if r.org == nil {
+		return
+	}
+	if err := r.refresh(context.TODO()); err != nil {
+		logger.Error("Cannot get accounts from AWS Organizations: ", err)
+	}
+}
+
+func (r *accountResolver) refresh(ctx context.Context) error {
+	accounts := map[string]AccountInfo{}
+	ouNames := map[string]string{}
+	paginator := organizations.NewListAccountsPaginator(r.org, &organizations.ListAccountsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, acc := range page.Accounts {
+			if acc.Id == nil {
+				continue
+			}
+			ou, err := r.accountOU(ctx, *acc.Id, ouNames)
+			if err != nil {
+				return err
+			}
+			accounts[*acc.Id] = AccountInfo{Name: aws.ToString(acc.Name), OU: ou}
+		}
+	}
+	r.mu.Lock()
+	r.accounts = accounts
+	r.mu.Unlock()
+	logger.Infof("Got %d accounts from AWS Organizations", len(accounts))
+	return nil
+}
+
+// accountOU returns the name of the direct parent OU of the account.
+// OU names are cached, since many accounts share the same OU
+func (r *accountResolver) accountOU(ctx context.Context, id string, ouNames map[string]string) (string, error) {
+	parents, err := r.org.ListParents(ctx, &organizations.ListParentsInput{ChildId: aws.String(id)})
+	if err != nil {
+		return "", fmt.Errorf("cannot list parents of %s: %w", id, err)
+	}
+	if len(parents.Parents) == 0 || parents.Parents[0].Id == nil {
+		return "", nil
+	}
+	parent := parents.Parents[0]
+	if parent.Type == orgtypes.ParentTypeRoot {
+		return rootOU, nil
+	}
+	if name, ok := ouNames[*parent.Id]; ok {
+		return name, nil
+	}
+	ou, err := r.org.DescribeOrganizationalUnit(ctx, &organizations.DescribeOrganizationalUnitInput{
+		OrganizationalUnitId: parent.Id,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot describe OU %s: %w", *parent.Id, err)
+	}
+	name := *parent.Id
+	if ou.OrganizationalUnit != nil && ou.OrganizationalUnit.Name != nil {
+		name = *ou.OrganizationalUnit.Name
+	}
+	ouNames[*parent.Id] = name
+	return name, nil
+}
+
+// lookup returns the account info from Organizations or from the static mapping
+func (r *accountResolver) lookup(id string) (AccountInfo, bool) {
+	r.mu.RLock()
+	info, ok := r.accounts[id]
+	r.mu.RUnlock()
+	if ok {
+		return info, true
+	}
+	info, ok = r.static[id]
+	return info, ok
+}
+
+// annotate adds account name and OU labels to the metrics with a linked account
+func (r *accountResolver) annotate(metrics []intmetrics.Metric) {
+	for _, m := range metrics {
+		id, ok := m.Tags[linkedAccountLabel]
+		if !ok {
+			continue
+		}
+		info, ok := r.lookup(id)
+		if !ok {
+			continue
+		}
+		m.Tags[accountNameLabel] = info.Name
+		if info.OU != "" {
+			m.Tags[ouLabel] = info.OU
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package clients
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeOrganizations struct {
+	describeCalls int
+}
+
+func (f *fakeOrganizations) ListAccounts(_ context.Context, _ *organizations.ListAccountsInput, _ ...func(*organizations.Options)) (*organizations.ListAccountsOutput, error) {
+	return &organizations.ListAccountsOutput{
+		Accounts: []orgtypes.Account{
+			{Id: aws.String("111111111111"), Name: aws.String("payer")},
+			{Id: aws.String("222222222222"), Name: aws.String("payments-prod")},
+			{Id: aws.String("333333333333"), Name: aws.String("payments-dev")},
+		},
+	}, nil
+}
+
+func (f *fakeOrganizations) ListParents(_ context.Context, in *organizations.ListParentsInput, _ ...func(*organizations.Options)) (*organizations.ListParentsOutput, error) {
+	if *in.ChildId == "111111111111" {
+		return &organizations.ListParentsOutput{
+			Parents: []orgtypes.Parent{{Id: aws.String("r-abcd"), Type: orgtypes.ParentTypeRoot}},
+		}, nil
+	}
+	return &organizations.ListParentsOutput{
+		Parents: []orgtypes.Parent{{Id: aws.String("ou-abcd-payments"), Type: orgtypes.ParentTypeOrganizationalUnit}},
+	}, nil
+}
+
+func (f *fakeOrganizations) DescribeOrganizationalUnit(_ context.Context, in *organizations.DescribeOrganizationalUnitInput, _ ...func(*organizations.Options)) (*organizations.DescribeOrganizationalUnitOutput, error) {
+	f.describeCalls++
+	return &organizations.DescribeOrganizationalUnitOutput{
+		OrganizationalUnit: &orgtypes.OrganizationalUnit{Id: in.OrganizationalUnitId, Name: aws.String("Payments")},
+	}, nil
+}
+
+func TestAccountResolverRefresh(t *testing.T) {
+	org := &fakeOrganizations{}
+	r := newAccountResolver(OrganizationsConfig{}, org)
+	assert.NoError(t, r.refresh(context.Background()))
+	// OU names are cached
+	assert.Equal(t, 1, org.describeCalls)
+
+	info, ok := r.lookup("111111111111")
+	assert.True(t, ok)
+	assert.Equal(t, AccountInfo{Name: "payer", OU: rootOU}, info)
+	info, ok = r.lookup("333333333333")
+	assert.True(t, ok)
+	assert.Equal(t, AccountInfo{Name: "payments-dev", OU: "Payments"}, info)
+}
+
+func TestAccountResolverAnnotate(t *testing.T) {
+	r := newAccountResolver(OrganizationsConfig{
+		Accounts: map[string]AccountInfo{"444444444444": {Name: "sandbox", OU: "Sandbox"}},
+	}, nil)
+	metrics := []intmetrics.Metric{
+		{Name: UNBL_COST, Tags: map[string]string{linkedAccountLabel: "444444444444"}},
+		{Name: UNBL_COST, Tags: map[string]string{linkedAccountLabel: "555555555555"}},
+		{Name: UNBL_COST, Tags: map[string]string{"service": AWS_CE_NAME}},
+	}
+	r.annotate(metrics)
+	assert.Equal(t, "sandbox", metrics[0].Tags[accountNameLabel])
+	assert.Equal(t, "Sandbox", metrics[0].Tags[ouLabel])
+	assert.NotContains(t, metrics[1].Tags, accountNameLabel)
+	assert.NotContains(t, metrics[2].Tags, accountNameLabel)
+}
+
+func TestAccountResolverUpdate(t *testing.T) {
+	r := newAccountResolver(OrganizationsConfig{}, &fakeOrganizations{})
+	r.update()
+	info, ok := r.lookup("222222222222")
+	assert.True(t, ok)
+	assert.Equal(t, "payments-prod", info.Name)
+
+	// Nothing to refresh without AWS Organizations
+	newAccountResolver(OrganizationsConfig{}, nil).update()
+}
@@ -0,0 +1,160 @@
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/grem11n/cost-exporter/logger"
+)
+
+// This file implements the replay and record modes of the AWS client.
+// In the record mode, live Cost Explorer responses are saved to JSON files.
+// In the replay mode, the responses are served from these files,
+// so the whole pipeline can run without AWS credentials
+
+// Supported AWS client modes
+const (
+	modeLive   = "live"
+	modeReplay = "replay"
+	modeRecord = "record"
+
+	defaultRecordingsDir = "./recordings"
+	recordingHashLength  = 16
+)
+
+var (
+	ErrMode        = errors.New("unsupported AWS client mode")
+	ErrNoRecording = errors.New("no recorded response found")
+)
+
+// costExplorerAPI is a subset of the Cost Explorer client used by the exporter
+type costExplorerAPI interface {
+	GetCostAndUsage(context.Context, *costexplorer.GetCostAndUsageInput, ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error)
+	GetCostForecast(context.Context, *costexplorer.GetCostForecastInput, ...func(*costexplorer.Options)) (*costexplorer.GetCostForecastOutput, error)
+	GetReservationUtilization(context.Context, *costexplorer.GetReservationUtilizationInput, ...func(*costexplorer.Options)) (*costexplorer.GetReservationUtilizationOutput, error)
+	GetReservationCoverage(context.Context, *costexplorer.GetReservationCoverageInput, ...func(*costexplorer.Options)) (*costexplorer.GetReservationCoverageOutput, error)
+	GetSavingsPlansUtilization(context.Context, *costexplorer.GetSavingsPlansUtilizationInput, ...func(*costexplorer.Options)) (*costexplorer.GetSavingsPlansUtilizationOutput, error)
+	GetSavingsPlansCoverage(context.Context, *costexplorer.GetSavingsPlansCoverageInput, ...func(*costexplorer.Options)) (*costexplorer.GetSavingsPlansCoverageOutput, error)
+	GetAnomalies(context.Context, *costexplorer.GetAnomaliesInput, ...func(*costexplorer.Options)) (*costexplorer.GetAnomaliesOutput, error)
+}
+
+// recorder serves recorded responses in the replay mode
+// and records the responses of the live client in the record mode
+type recorder struct {
+	dir  string
+	live costExplorerAPI // nil in the replay mode
+}
+
+func newRecorder(dir string, live costExplorerAPI) *recorder {
+	return &recorder{dir: dir, live: live}
+}
+
+func (r *recorder) GetCostAndUsage(ctx context.Context, in *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	return replay(r, "GetCostAndUsage", in, func() (*costexplorer.GetCostAndUsageOutput, error) {
+		return r.live.GetCostAndUsage(ctx, in, optFns...)
+	})
+}
+
+func (r *recorder) GetCostForecast(ctx context.Context, in *costexplorer.GetCostForecastInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostForecastOutput, error) {
+	return replay(r, "GetCostForecast", in, func() (*costexplorer.GetCostForecastOutput, error) {
+		return r.live.GetCostForecast(ctx, in, optFns...)
+	})
+}
+
+func (r *recorder) GetReservationUtilization(ctx context.Context, in *costexplorer.GetReservationUtilizationInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetReservationUtilizationOutput, error) {
+	return replay(r, "GetReservationUtilization", in, func() (*costexplorer.GetReservationUtilizationOutput, error) {
+		return r.live.GetReservationUtilization(ctx, in, optFns...)
+	})
+}
+
+func (r *recorder) GetReservationCoverage(ctx context.Context, in *costexplorer.GetReservationCoverageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetReservationCoverageOutput, error) {
+	return replay(r, "GetReservationCoverage", in, func() (*costexplorer.GetReservationCoverageOutput, error) {
+		return r.live.GetReservationCoverage(ctx, in, optFns...)
+	})
+}
+
+func (r *recorder) GetSavingsPlansUtilization(ctx context.Context, in *costexplorer.GetSavingsPlansUtilizationInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetSavingsPlansUtilizationOutput, error) {
+	return replay(r, "GetSavingsPlansUtilization", in, func() (*costexplorer.GetSavingsPlansUtilizationOutput, error) {
+		return r.live.GetSavingsPlansUtilization(ctx, in, optFns...)
+	})
+}
+
+func (r *recorder) GetSavingsPlansCoverage(ctx context.Context, in *costexplorer.GetSavingsPlansCoverageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetSavingsPlansCoverageOutput, error) {
+	return replay(r, "GetSavingsPlansCoverage", in, func() (*costexplorer.GetSavingsPlansCoverageOutput, error) {
+		return r.live.GetSavingsPlansCoverage(ctx, in, optFns...)
+	})
+}
+
+func (r *recorder) GetAnomalies(ctx context.Context, in *costexplorer.GetAnomaliesInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetAnomaliesOutput, error) {
+	return replay(r, "GetAnomalies", in, func() (*costexplorer.GetAnomaliesOutput, error) {
+		return r.live.GetAnomalies(ctx, in, optFns...)
+	})
+}
+
+// replay either reads the recorded response or makes a live call and records its response
+func replay[In any, Out any](r *recorder, operation string, in *In, call func() (*Out, error)) (*Out, error) {
+	path, err := r.recordingPath(operation, in)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.live == nil {
+		logger.Debugf("Replaying %s from %s", operation, path)
+		data, err := os.ReadFile(path) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("%w for %s: %w", ErrNoRecording, operation, err)
+		}
+		var out Out
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, fmt.Errorf("cannot decode the recorded %s response %s: %w", operation, path, err)
+		}
+		return &out, nil
+	}
+
+	out, err := call()
+	if err != nil || out == nil {
+		return out, err
+	}
+	logger.Debugf("Recording %s to %s", operation, path)
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode the %s response: %w", operation, err)
+	}
+	if err := os.MkdirAll(r.dir, 0o750); err != nil {
+		return nil, fmt.Errorf("cannot create the recordings directory %s: %w", r.dir, err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("cannot record the %s response to %s: %w", operation, path, err)
+	}
+	return out, nil
+}
+
+// recordingPath returns the file name for the request.
+// Time periods change on every refresh, so they are not a part of the name.
+// Otherwise, recordings would never match in the replay mode
+func (r *recorder) recordingPath(operation string, in any) (string, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode the %s request: %w", operation, err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("cannot encode the %s request: %w", operation, err)
+	}
+	delete(fields, "TimePeriod")
+	delete(fields, "DateInterval")
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode the %s request: %w", operation, err)
+	}
+	sum := sha256.Sum256(data)
+	name := fmt.Sprintf("%s-%s.json", operation, hex.EncodeToString(sum[:])[:recordingHashLength])
+	return filepath.Join(r.dir, name), nil
+}
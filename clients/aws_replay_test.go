@@ -0,0 +1,66 @@
+package clients
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCostExplorer serves CeStub responses instead of calling AWS
+type fakeCostExplorer struct {
+	costExplorerAPI
+	calls int
+}
+
+func (f *fakeCostExplorer) GetCostAndUsage(_ context.Context, _ *costexplorer.GetCostAndUsageInput, _ ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	f.calls++
+	return CeStub[1], nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	live := &fakeCostExplorer{}
+	rec := &account{name: "test", ce: newRecorder(dir, live)}
+	recorded, err := rec.fetch(&testMetric)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, live.calls)
+	assert.Len(t, recorded, 8)
+
+	rep := &account{name: "test", ce: newRecorder(dir, nil)}
+	replayed, err := rep.fetch(&testMetric)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, live.calls)
+	assert.ElementsMatch(t, recorded, replayed)
+}
+
+func TestReplayMissingRecording(t *testing.T) {
+	rep := &account{name: "test", ce: newRecorder(t.TempDir(), nil)}
+	_, err := rep.fetch(&testMetric)
+	assert.ErrorIs(t, err, ErrNoRecording)
+}
+
+func TestRecordingPathIgnoresTimePeriod(t *testing.T) {
+	r := newRecorder("recordings", nil)
+	first, err := buildCostAndUsageInput(&testMetric, nil)
+	assert.NoError(t, err)
+	second, err := buildCostAndUsageInput(&testMetric, nil)
+	assert.NoError(t, err)
+	second.TimePeriod.Start = first.TimePeriod.End
+	firstPath, err := r.recordingPath("GetCostAndUsage", first)
+	assert.NoError(t, err)
+	secondPath, err := r.recordingPath("GetCostAndUsage", second)
+	assert.NoError(t, err)
+	assert.Equal(t, firstPath, secondPath)
+}
+
+func TestNewCostExplorerMode(t *testing.T) {
+	_, err := newCostExplorer(&AWSConfig{Mode: "dry-run"}, aws.Config{}, &AccountConfig{Name: "test"}, newLimiter(LimitsConfig{}))
+	assert.ErrorIs(t, err, ErrMode)
+
+	ce, err := newCostExplorer(&AWSConfig{Mode: modeReplay, RecordingsDir: "fixtures"}, aws.Config{}, &AccountConfig{Name: "test"}, newLimiter(LimitsConfig{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "fixtures/test", ce.(*recorder).dir) //nolint:forcetypeassert
+}
@@ -8,6 +8,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/enriquebris/goconcurrentqueue"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/store"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -81,7 +84,258 @@ func TestBuildCostAndUsageInputFilter(t *testing.T) {
 
 func TestGenerateInitialInputs(t *testing.T) {
 	metrics := []*MetricsConfig{&testMetric}
-	inputs := generateInitialInputs(metrics)
+	inputs := generateInitialInputs(defaultAccountName, metrics, RetryConfig{})
 	assert.Equal(t, 1, inputs.GetCap())
 	assert.Equal(t, 1, inputs.GetLen())
 }
+
+func TestAccountConfigsDefault(t *testing.T) {
+	cfg := AWSConfig{AssumeRole: "CrossAccountRole"}
+	got := accountConfigs(&cfg)
+	assert.Equal(t, []*AccountConfig{{Name: defaultAccountName, AssumeRole: "CrossAccountRole", BillingCurrency: "USD"}}, got)
+}
+
+func TestAccountConfigsNames(t *testing.T) {
+	cfg := AWSConfig{
+		Accounts: []*AccountConfig{
+			{Name: "payer", AssumeRole: "arn:aws:iam::111111111111:role/CostExporter"},
+			{AssumeRole: "arn:aws:iam::222222222222:role/CostExporter", BillingCurrency: "eur"},
+		},
+	}
+	got := accountConfigs(&cfg)
+	assert.Len(t, got, 2)
+	assert.Equal(t, "payer", got[0].Name)
+	assert.Equal(t, "account_1", got[1].Name)
+	assert.Equal(t, "USD", got[0].BillingCurrency)
+	assert.Equal(t, "EUR", got[1].BillingCurrency)
+}
+
+func TestConvertStub(t *testing.T) {
+	out := []costexplorer.GetCostAndUsageOutput{}
+	for _, o := range CeStub {
+		out = append(out, *o)
+	}
+	got := convert(out, "")
+	// 5 groups in total with 2 metrics each
+	assert.Len(t, got, 10)
+	for _, m := range got {
+		assert.Equal(t, metricsPrefix, m.Prefix)
+		assert.Contains(t, m.Tags, "service")
+		assert.Equal(t, "2024-10-01", m.Tags["period_start"])
+		assert.Equal(t, "2024-10-02", m.Tags["period_end"])
+	}
+}
+
+func TestConvertAllBucketsAndKeys(t *testing.T) {
+	out := []costexplorer.GetCostAndUsageOutput{
+		{
+			GroupDefinitions: []types.GroupDefinition{
+				{Key: aws.String("SERVICE"), Type: types.GroupDefinitionTypeDimension},
+				{Key: aws.String("LINKED_ACCOUNT"), Type: types.GroupDefinitionTypeDimension},
+				{Key: aws.String("team"), Type: types.GroupDefinitionTypeTag},
+			},
+			ResultsByTime: []types.ResultByTime{
+				{
+					Groups: []types.Group{
+						{
+							Keys: []string{AWS_CE_NAME, "111111111111", "team$payments"},
+							Metrics: map[string]types.MetricValue{
+								UNBL_COST: {Amount: aws.String("1.5"), Unit: aws.String("USD")},
+							},
+						},
+					},
+					TimePeriod: &types.DateInterval{Start: aws.String("2024-10-01"), End: aws.String("2024-10-02")},
+				},
+				{
+					Groups: []types.Group{
+						{
+							Keys: []string{AWS_CE_NAME, "111111111111", "team$payments"},
+							Metrics: map[string]types.MetricValue{
+								UNBL_COST: {Amount: aws.String("2.5"), Unit: aws.String("USD")},
+							},
+						},
+					},
+					TimePeriod: &types.DateInterval{Start: aws.String("2024-10-02"), End: aws.String("2024-10-03")},
+				},
+			},
+		},
+	}
+	got := convert(out, "")
+	assert.Len(t, got, 2)
+	assert.Equal(t, map[string]string{
+		"service":        AWS_CE_NAME,
+		"linked_account": "111111111111",
+		"tag_team":       "payments",
+		"period_start":   "2024-10-02",
+		"period_end":     "2024-10-03",
+		"currency":       "USD",
+		"estimated":      "false",
+	}, got[1].Tags)
+	assert.InDelta(t, 2.5, got[1].Value, 0.0001)
+	assert.Equal(t, "USD", got[1].Unit)
+}
+
+func TestConvertEstimated(t *testing.T) {
+	out := []costexplorer.GetCostAndUsageOutput{
+		{
+			ResultsByTime: []types.ResultByTime{
+				{
+					Total: map[string]types.MetricValue{
+						UNBL_COST: {Amount: aws.String("10"), Unit: aws.String("USD")},
+					},
+					TimePeriod: &types.DateInterval{Start: aws.String("2024-10-01"), End: aws.String("2024-10-02")},
+				},
+				{
+					Estimated: true,
+					Total: map[string]types.MetricValue{
+						UNBL_COST: {Amount: aws.String("2"), Unit: aws.String("USD")},
+					},
+					TimePeriod: &types.DateInterval{Start: aws.String("2024-10-02"), End: aws.String("2024-10-03")},
+				},
+			},
+		},
+	}
+	got := convert(out, "")
+	assert.Len(t, got, 2)
+	assert.Equal(t, "false", got[0].Tags[estimatedLabel])
+	assert.Equal(t, "true", got[1].Tags[estimatedLabel])
+
+	final := dropEstimated(got)
+	assert.Len(t, final, 1)
+	assert.Equal(t, "2024-10-01", final[0].Tags["period_start"])
+}
+
+func TestConvertTotals(t *testing.T) {
+	out := []costexplorer.GetCostAndUsageOutput{
+		{
+			ResultsByTime: []types.ResultByTime{
+				{
+					Total: map[string]types.MetricValue{
+						UNBL_COST: {Amount: aws.String("42"), Unit: aws.String("USD")},
+					},
+				},
+			},
+		},
+	}
+	got := convert(out, "")
+	assert.Len(t, got, 1)
+	assert.Equal(t, UNBL_COST, got[0].Name)
+	assert.InDelta(t, 42.0, got[0].Value, 0.0001)
+}
+
+func TestAnnotate(t *testing.T) {
+	m := MetricsConfig{
+		Name:             "daily_cost",
+		MetricNamePrefix: "aws_billing",
+		Help:             "Daily cost per service",
+		Labels:           map[string]string{"team": "finops", "service": "static"},
+	}
+	got := m.annotate([]intmetrics.Metric{
+		{Name: UNBL_COST, Prefix: metricsPrefix, Tags: map[string]string{"service": AWS_CE_NAME}},
+	}, "payer")
+	assert.Equal(t, "daily_cost", got[0].Query)
+	assert.Equal(t, "aws_billing", got[0].Prefix)
+	assert.Equal(t, "Daily cost per service", got[0].Help)
+	assert.Equal(t, map[string]string{
+		"service": AWS_CE_NAME,
+		"team":    "finops",
+		"account": "payer",
+		"query":   "daily_cost",
+	}, got[0].Tags)
+}
+
+func TestRefreshInterval(t *testing.T) {
+	client := AWS{accounts: []*account{
+		{queries: []*MetricsConfig{{Granularity: "hourly"}}},
+		{queries: []*MetricsConfig{{Granularity: "hourly"}, {Granularity: "daily"}}},
+	}}
+	assert.Equal(t, 24*time.Hour, client.RefreshInterval())
+	client.accounts = client.accounts[:1]
+	assert.Equal(t, time.Hour, client.RefreshInterval())
+}
+
+func TestNameQueries(t *testing.T) {
+	named := testMetric
+	named.Name = "daily_cost"
+	unnamed := testMetric
+	unnamed.Name = ""
+	assert.NoError(t, nameQueries([]*MetricsConfig{&named, &unnamed}))
+	assert.Equal(t, "daily_cost", named.Name)
+	assert.Equal(t, "query_1", unnamed.Name)
+
+	duplicate := testMetric
+	duplicate.Name = "daily_cost"
+	assert.ErrorIs(t, nameQueries([]*MetricsConfig{&named, &duplicate}), ErrDuplicateQuery)
+
+	// Default names can clash with the explicit ones
+	explicit := testMetric
+	explicit.Name = "query_1"
+	unnamed.Name = ""
+	assert.ErrorIs(t, nameQueries([]*MetricsConfig{&explicit, &unnamed}), ErrDuplicateQuery)
+}
+
+func TestGroupValue(t *testing.T) {
+	defs := []types.GroupDefinition{
+		{Key: aws.String("SERVICE"), Type: types.GroupDefinitionTypeDimension},
+		{Key: aws.String("team"), Type: types.GroupDefinitionTypeTag},
+		{Key: aws.String("Cost Center"), Type: types.GroupDefinitionTypeCostCategory},
+	}
+	assert.Equal(t, "Amazon S3", groupValue(defs, 0, "Amazon S3", ""))
+	assert.Equal(t, "payments", groupValue(defs, 1, "team$payments", ""))
+	assert.Equal(t, defaultUntaggedValue, groupValue(defs, 1, "team$", ""))
+	assert.Equal(t, "none", groupValue(defs, 1, "team$", "none"))
+	assert.Equal(t, "R&D", groupValue(defs, 2, "Cost Center$R&D", ""))
+	assert.Equal(t, "cost_category_cost_center", groupLabel(defs, 2))
+}
+
+func TestGetMetricsOnce(t *testing.T) {
+	ce := &fakeCostExplorer{}
+	daily := testMetric
+	daily.Name = "daily"
+	invalid := MetricsConfig{Name: "invalid", Granularity: "yearly"}
+	a := &AWS{
+		namespace: defaultNamespace,
+		resolver:  newAccountResolver(OrganizationsConfig{}, nil),
+		accounts: []*account{{
+			name:      "payer",
+			namespace: defaultNamespace,
+			ce:        ce,
+			queries:   []*MetricsConfig{&daily, &invalid},
+			resolver:  newAccountResolver(OrganizationsConfig{}, nil),
+		}},
+	}
+	st := store.New(store.Config{})
+	assert.NoError(t, a.GetMetricsOnce(st))
+	assert.Equal(t, 1, ce.calls)
+	got := st.Snapshot(defaultNamespace)
+	// The invalid query is skipped, so only the metrics of the fake response are stored
+	assert.Len(t, got, len(convert([]costexplorer.GetCostAndUsageOutput{*CeStub[1]}, "")))
+	assert.Equal(t, "daily", got[0].Tags["query"])
+	assert.Equal(t, "payer", got[0].Tags["account"])
+}
+
+func TestValidateRollingWindow(t *testing.T) {
+	tm := testMetric
+	tm.Window = WindowConfig{Rolling: "12h"}
+	assert.ErrorIs(t, tm.validate(), ErrWindow)
+	tm.Window = WindowConfig{Rolling: "1d"}
+	assert.NoError(t, tm.validate())
+}
+
+func TestGetMetricsWaitsForBreaker(t *testing.T) {
+	ce := &fakeCostExplorer{}
+	a := &account{name: "payer", ce: ce, inputs: goconcurrentqueue.NewFixedFIFO(1)}
+	b := newBreaker("payer", "open", RetryConfig{})
+	b.state = breakerOpen
+	b.nextRetry = time.Now().Add(200 * time.Millisecond)
+	in := input{metric: &testMetric, breaker: b, readyTs: time.Now().Unix()}
+	assert.Equal(t, b.nextRetry, in.readyAt())
+	assert.NoError(t, a.inputs.Enqueue(in))
+
+	start := time.Now()
+	a.getMetrics(store.New(store.Config{}))
+	// The input is put back and the account waits for the breaker instead of dequeuing it again
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	assert.Equal(t, 0, ce.calls)
+	assert.Equal(t, 1, a.inputs.GetLen())
+}
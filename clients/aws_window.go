@@ -0,0 +1,188 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/grem11n/cost-exporter/logger"
+)
+
+// This file implements configurable time windows for the queries
+
+// Supported window types
+const (
+	windowMonthToDate   = "month_to_date"
+	windowPreviousMonth = "previous_month"
+	windowYearToDate    = "year_to_date"
+	windowRolling       = "rolling"
+	windowFixed         = "fixed"
+)
+
+var (
+	ErrWindow = errors.New("invalid time window")
+)
+
+// WindowConfig sets the time period of a query.
+// It can be set either as a string, e.g. `window: month_to_date`
+// or as a map, e.g. `window: {rolling: 7d}` or `window: {start: 2024-01-01, end: 2024-02-01}`.
+// If not set, the lookback depends on the granularity
+type WindowConfig struct {
+	Type    string `mapstructure:"type,omitempty"`
+	Rolling string `mapstructure:"rolling,omitempty"`
+	Start   string `mapstructure:"start,omitempty"`
+	End     string `mapstructure:"end,omitempty"`
+}
+
+// windowDecodeHook allows to set the window as a plain string in the config
+func windowDecodeHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to != reflect.TypeOf(WindowConfig{}) {
+		return data, nil
+	}
+	return WindowConfig{Type: data.(string)}, nil //nolint:forcetypeassert
+}
+
+func (w *WindowConfig) windowType() string {
+	switch {
+	case w.Type != "":
+		return strings.ToLower(w.Type)
+	case w.Rolling != "":
+		return windowRolling
+	case w.Start != "" || w.End != "":
+		return windowFixed
+	default:
+		return ""
+	}
+}
+
+// timePeriod returns the time period of the query
+func timePeriod(metric *MetricsConfig) (*types.DateInterval, error) {
+	return metric.Window.resolve(time.Now().UTC(), metric.Granularity)
+}
+
+// resolve returns the time period of the window relative to now.
+// Calendar windows include today, so the end date is tomorrow,
+// since the end date is exclusive in Cost Explorer
+func (w *WindowConfig) resolve(now time.Time, granularity string) (*types.DateInterval, error) {
+	if _, err := granularityLookback(granularity); err != nil {
+		return nil, err
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	tomorrow := today.AddDate(0, 0, 1)
+	var start, end time.Time
+
+	switch w.windowType() {
+	case "":
+		// Default lookback depends on the granularity
+		lookback, _ := granularityLookback(granularity) //nolint:errcheck
+		start, end = now.Add(-lookback), now
+	case windowMonthToDate:
+		start, end = today.AddDate(0, 0, 1-today.Day()), tomorrow
+	case windowPreviousMonth:
+		end = today.AddDate(0, 0, 1-today.Day())
+		start = end.AddDate(0, -1, 0)
+	case windowYearToDate:
+		start, end = time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC), tomorrow
+	case windowRolling:
+		lookback, err := parseLookback(w.Rolling)
+		if err != nil {
+			return nil, err
+		}
+		// A shorter window may start and end on the same date, which Cost Explorer rejects
+		if lookback < granularityStep(granularity) {
+			return nil, fmt.Errorf("%w: rolling window %s is shorter than the %s granularity", ErrWindow, w.Rolling, granularity)
+		}
+		start, end = now.Add(-lookback), now
+	case windowFixed:
+		var err error
+		if start, end, err = w.fixedPeriod(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %s", ErrWindow, w.Type)
+	}
+
+	return &types.DateInterval{
+		Start: aws.String(formatDate(start, granularity)),
+		End:   aws.String(formatDate(end, granularity)),
+	}, nil
+}
+
+// fixedPeriod parses explicitly configured start and end dates,
+// so invalid ones are rejected before they get to Cost Explorer
+func (w *WindowConfig) fixedPeriod() (time.Time, time.Time, error) {
+	if w.Start == "" || w.End == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: both start and end dates are required", ErrWindow)
+	}
+	start, err := time.Parse(time.DateOnly, w.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: cannot parse start date %s", ErrWindow, w.Start)
+	}
+	end, err := time.Parse(time.DateOnly, w.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: cannot parse end date %s", ErrWindow, w.End)
+	}
+	// The end date is exclusive, so the same dates would be an empty period
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: start date %s is not before end date %s", ErrWindow, w.Start, w.End)
+	}
+	return start, end, nil
+}
+
+// granularityLookback returns the default lookback for the granularity
+func granularityLookback(granularity string) (time.Duration, error) {
+	switch strings.ToLower(granularity) {
+	case "monthly":
+		return 730 * time.Hour, nil
+	case "daily":
+		return 24 * time.Hour, nil
+	case "hourly":
+		return 1 * time.Hour, nil
+	default:
+		logger.Errorf("unsupported granularity: %s. Supported: monthly, daily, hourly", granularity)
+		return 0, ErrGranularity
+	}
+}
+
+// granularityStep returns the shortest bucket of the granularity
+func granularityStep(granularity string) time.Duration {
+	switch strings.ToLower(granularity) {
+	case "monthly":
+		return 28 * 24 * time.Hour
+	case "daily":
+		return 24 * time.Hour
+	default:
+		return 1 * time.Hour
+	}
+}
+
+// formatDate formats the date in the format required by the granularity.
+// AWS requires timestamps for the hourly granularity and dates otherwise
+func formatDate(t time.Time, granularity string) string {
+	if strings.EqualFold(granularity, "hourly") {
+		return t.Format(time.RFC3339)
+	}
+	return t.Format(time.DateOnly)
+}
+
+// parseLookback parses durations with the day suffix, e.g. `7d`,
+// as well as the regular Go durations, e.g. `12h`
+func parseLookback(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("%w: cannot parse rolling window %s", ErrWindow, s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: cannot parse rolling window %s", ErrWindow, s)
+	}
+	return d, nil
+}
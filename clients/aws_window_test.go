@@ -0,0 +1,109 @@
+package clients
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2024, 10, 15, 13, 30, 0, 0, time.UTC)
+
+func TestWindowResolve(t *testing.T) {
+	tests := []struct {
+		name        string
+		window      WindowConfig
+		granularity string
+		start       string
+		end         string
+	}{
+		{"default monthly", WindowConfig{}, "monthly", "2024-09-15", "2024-10-15"},
+		{"default hourly", WindowConfig{}, "hourly", "2024-10-15T12:30:00Z", "2024-10-15T13:30:00Z"},
+		{"month to date", WindowConfig{Type: windowMonthToDate}, "daily", "2024-10-01", "2024-10-16"},
+		{"previous month", WindowConfig{Type: windowPreviousMonth}, "monthly", "2024-09-01", "2024-10-01"},
+		{"year to date", WindowConfig{Type: windowYearToDate}, "monthly", "2024-01-01", "2024-10-16"},
+		{"rolling days", WindowConfig{Rolling: "7d"}, "daily", "2024-10-08", "2024-10-15"},
+		{"rolling hours", WindowConfig{Rolling: "2h"}, "hourly", "2024-10-15T11:30:00Z", "2024-10-15T13:30:00Z"},
+		{"fixed", WindowConfig{Start: "2024-01-01", End: "2024-02-01"}, "daily", "2024-01-01", "2024-02-01"},
+		{"fixed hours", WindowConfig{Start: "2024-01-01", End: "2024-01-02"}, "hourly", "2024-01-01T00:00:00Z", "2024-01-02T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.window.resolve(testNow, tt.granularity)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.start, *got.Start)
+			assert.Equal(t, tt.end, *got.End)
+		})
+	}
+}
+
+func TestWindowResolveErrors(t *testing.T) {
+	_, err := (&WindowConfig{Rolling: "a week"}).resolve(testNow, "daily")
+	assert.ErrorIs(t, err, ErrWindow)
+	_, err = (&WindowConfig{Start: "2024-01-01"}).resolve(testNow, "daily")
+	assert.ErrorIs(t, err, ErrWindow)
+	_, err = (&WindowConfig{Type: "fortnight"}).resolve(testNow, "daily")
+	assert.ErrorIs(t, err, ErrWindow)
+	// The start and the end dates would be the same
+	_, err = (&WindowConfig{Rolling: "12h"}).resolve(testNow, "daily")
+	assert.ErrorIs(t, err, ErrWindow)
+	_, err = (&WindowConfig{Rolling: "7d"}).resolve(testNow, "monthly")
+	assert.ErrorIs(t, err, ErrWindow)
+	_, err = (&WindowConfig{}).resolve(testNow, "weekly")
+	assert.ErrorIs(t, err, ErrGranularity)
+}
+
+func TestFixedWindowErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		window WindowConfig
+	}{
+		{"missing end", WindowConfig{Start: "2024-01-01"}},
+		{"invalid start", WindowConfig{Start: "2024-13-01", End: "2024-02-01"}},
+		{"invalid end", WindowConfig{Start: "2024-01-01", End: "01/02/2024"}},
+		{"same dates", WindowConfig{Start: "2024-01-01", End: "2024-01-01"}},
+		{"end before start", WindowConfig{Start: "2024-02-01", End: "2024-01-01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.window.resolve(testNow, "daily")
+			assert.ErrorIs(t, err, ErrWindow)
+			// Invalid queries are rejected when the config is loaded
+			tm := testMetric
+			tm.Window = tt.window
+			assert.ErrorIs(t, tm.validate(), ErrWindow)
+		})
+	}
+}
+
+func TestWindowDecodeHook(t *testing.T) {
+	var got []MetricsConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: windowDecodeHook,
+		Result:     &got,
+	})
+	assert.NoError(t, err)
+	err = decoder.Decode([]map[string]any{
+		{"granularity": "daily", "window": "month_to_date"},
+		{"granularity": "daily", "window": map[string]any{"rolling": "7d"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, windowMonthToDate, got[0].Window.windowType())
+	assert.Equal(t, windowRolling, got[1].Window.windowType())
+	assert.Equal(t, "7d", got[1].Window.Rolling)
+}
+
+func TestBuildCostAndUsageInputWindow(t *testing.T) {
+	tm := testMetric
+	tm.Window = WindowConfig{Type: windowPreviousMonth}
+	got, err := buildCostAndUsageInput(&tm, nil)
+	assert.NoError(t, err)
+	firstOfMonth := time.Date(time.Now().UTC().Year(), time.Now().UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, &types.DateInterval{
+		Start: aws.String(firstOfMonth.AddDate(0, -1, 0).Format("2006-01-02")),
+		End:   aws.String(firstOfMonth.Format("2006-01-02")),
+	}, got.TimePeriod)
+}
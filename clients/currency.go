@@ -0,0 +1,151 @@
+package clients
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/spf13/viper"
+)
+
+// This file implements normalization of costs into a single reporting currency
+
+const (
+	currencyLabel                  = "currency"
+	defaultCurrencyRefreshInterval = 1 * time.Hour
+	currencyRateName               = "cost_exporter_currency_rate{job=\"cost-exporter\",from=%q,to=%q}"
+)
+
+// CurrencyConfig configures the normalization of costs into the reporting currency.
+// Rates are the price of one unit of a currency in the reporting currency, e.g. `EUR: 1.08`.
+// Rates from the file take precedence over the static ones.
+// The file can be in any format supported by the config, e.g. YAML or JSON
+type CurrencyConfig struct {
+	Reporting       string             `mapstructure:"reporting,omitempty"`
+	Rates           map[string]float64 `mapstructure:"rates,omitempty"`
+	RatesFile       string             `mapstructure:"rates_file,omitempty"`
+	RefreshInterval time.Duration      `mapstructure:"refresh_interval,omitempty"`
+}
+
+type currencyConverter struct {
+	mu        sync.RWMutex
+	reporting string
+	static    map[string]float64
+	rates     map[string]float64
+	file      string
+	interval  time.Duration
+}
+
+// newCurrencyConverter returns nil if no reporting currency is set
+func newCurrencyConverter(cfg CurrencyConfig) *currencyConverter {
+	if cfg.Reporting == "" {
+		return nil
+	}
+	interval := cfg.RefreshInterval
+	if interval <= 0 {
+		interval = defaultCurrencyRefreshInterval
+	}
+	c := &currencyConverter{
+		reporting: strings.ToUpper(cfg.Reporting),
+		// Config keys are lowercased when the config is read
+		static:   upperKeys(cfg.Rates),
+		file:     cfg.RatesFile,
+		interval: interval,
+	}
+	c.setRates(map[string]float64{})
+	if c.file != "" {
+		if err := c.loadFile(); err != nil {
+			logger.Error("Cannot load currency rates: ", err)
+		}
+	}
+	return c
+}
+
+// run reloads the rates file on the interval
+func (c *currencyConverter) run() {
+	if c == nil || c.file == "" {
+		return
+	}
+	for {
+		time.Sleep(c.interval)
+		if err := c.loadFile(); err != nil {
+			logger.Error("Cannot reload currency rates: ", err)
+		}
+	}
+}
+
+func (c *currencyConverter) loadFile() error {
+	v := viper.New()
+	v.SetConfigFile(c.file)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("unable to read the rates file %s: %w", c.file, err)
+	}
+	var rates map[string]float64
+	if err := v.Unmarshal(&rates); err != nil {
+		return fmt.Errorf("unable to read the rates file %s: %w", c.file, err)
+	}
+	c.setRates(upperKeys(rates))
+	logger.Infof("Loaded %d currency rates from %s", len(rates), c.file)
+	return nil
+}
+
+// setRates merges the rates with the static ones
+// and exposes each rate as a gauge
+func (c *currencyConverter) setRates(rates map[string]float64) {
+	merged := map[string]float64{c.reporting: 1}
+	for k, v := range c.static {
+		merged[k] = v
+	}
+	for k, v := range rates {
+		merged[k] = v
+	}
+	c.mu.Lock()
+	c.rates = merged
+	c.mu.Unlock()
+	for from := range merged {
+		intmetrics.InternalMetricsSet.GetOrCreateGauge(fmt.Sprintf(currencyRateName, from, c.reporting), func() float64 {
+			rate, _ := c.rate(from)
+			return rate
+		})
+	}
+}
+
+func (c *currencyConverter) rate(from string) (float64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	rate, ok := c.rates[strings.ToUpper(from)]
+	return rate, ok
+}
+
+// normalize converts the costs into the reporting currency in place.
+// Costs in currencies without a known rate are left as is
+func (c *currencyConverter) normalize(metrics []intmetrics.Metric) {
+	if c == nil {
+		return
+	}
+	for i := range metrics {
+		from := metrics[i].Unit
+		if !intmetrics.IsCurrency(from) || from == c.reporting {
+			continue
+		}
+		rate, ok := c.rate(from)
+		if !ok {
+			logger.Warnf("No currency rate for %s, keeping the original currency", from)
+			continue
+		}
+		metrics[i].Value *= rate
+		metrics[i].Unit = c.reporting
+		metrics[i].Tags[currencyLabel] = c.reporting
+	}
+}
+
+func upperKeys(m map[string]float64) map[string]float64 {
+	res := make(map[string]float64, len(m))
+	for k, v := range m {
+		res[strings.ToUpper(k)] = v
+	}
+	return res
+}
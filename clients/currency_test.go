@@ -0,0 +1,73 @@
+package clients
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCurrencyConverterDisabled(t *testing.T) {
+	c := newCurrencyConverter(CurrencyConfig{})
+	assert.Nil(t, c)
+	metrics := []intmetrics.Metric{{Value: 1, Unit: "EUR", Tags: map[string]string{currencyLabel: "EUR"}}}
+	c.normalize(metrics)
+	assert.Equal(t, 1.0, metrics[0].Value)
+}
+
+func TestCurrencyNormalize(t *testing.T) {
+	c := newCurrencyConverter(CurrencyConfig{
+		Reporting: "usd",
+		Rates:     map[string]float64{"eur": 1.5},
+	})
+	metrics := []intmetrics.Metric{
+		{Value: 2, Unit: "EUR", Tags: map[string]string{currencyLabel: "EUR"}},
+		{Value: 3, Unit: "USD", Tags: map[string]string{currencyLabel: "USD"}},
+		{Value: 4, Unit: "GBP", Tags: map[string]string{currencyLabel: "GBP"}},
+		{Value: 5, Unit: "Hrs", Tags: map[string]string{}},
+	}
+	c.normalize(metrics)
+	assert.Equal(t, 3.0, metrics[0].Value)
+	assert.Equal(t, "USD", metrics[0].Unit)
+	assert.Equal(t, "USD", metrics[0].Tags[currencyLabel])
+	assert.Equal(t, 3.0, metrics[1].Value)
+	// Unknown rates keep the original currency
+	assert.Equal(t, 4.0, metrics[2].Value)
+	assert.Equal(t, "GBP", metrics[2].Unit)
+	assert.Equal(t, 5.0, metrics[3].Value)
+}
+
+func TestCurrencyRatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("EUR: 1.1\nGBP: 1.3\n"), 0o600))
+	c := newCurrencyConverter(CurrencyConfig{
+		Reporting: "USD",
+		Rates:     map[string]float64{"EUR": 1.5},
+		RatesFile: path,
+	})
+	rate, ok := c.rate("EUR")
+	assert.True(t, ok)
+	assert.Equal(t, 1.1, rate)
+	rate, ok = c.rate("gbp")
+	assert.True(t, ok)
+	assert.Equal(t, 1.3, rate)
+}
+
+func TestConvertMetricValuesCurrency(t *testing.T) {
+	got := convertMetricValues(map[string]types.MetricValue{
+		"UnblendedCost": {Amount: aws.String("1.5"), Unit: aws.String("USD")},
+		"UsageQuantity": {Amount: aws.String("10"), Unit: aws.String("Hrs")},
+	}, map[string]string{})
+	assert.Len(t, got, 2)
+	for _, m := range got {
+		if intmetrics.IsCurrency(m.Unit) {
+			assert.Equal(t, m.Unit, m.Tags[currencyLabel])
+		} else {
+			assert.NotContains(t, m.Tags, currencyLabel)
+		}
+	}
+}
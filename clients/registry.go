@@ -1,11 +1,37 @@
 package clients
 
-import "sync"
+import (
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/store"
+)
 
 type ClientConfig any
 
 type Client interface {
-	GetMetrics(*sync.Map)
+	GetMetrics(*store.Store)
+	// Namespace is a store namespace of the client metrics,
+	// which converters subscribe to
+	Namespace() string
+}
+
+// Backfiller is implemented by the clients, which can fetch historical metrics.
+// The metrics are passed to write with their original timestamps
+type Backfiller interface {
+	Backfill(from, to time.Time, write func([]intmetrics.Metric) error) error
+}
+
+// OnceClient is implemented by the clients, which can fetch all the metrics once
+// for the one-shot run mode instead of refreshing them in a loop
+type OnceClient interface {
+	GetMetricsOnce(*store.Store) error
+}
+
+// Refresher is implemented by the clients, which refresh their metrics periodically.
+// RefreshInterval is the longest interval between the refreshes of a query
+type Refresher interface {
+	RefreshInterval() time.Duration
 }
 
 type ClientFactory func(ClientConfig) Client
@@ -6,14 +6,17 @@ import (
 	"os"
 
 	"github.com/grem11n/cost-exporter/clients"
+	"github.com/grem11n/cost-exporter/converters"
 	"github.com/grem11n/cost-exporter/logger"
 	"github.com/grem11n/cost-exporter/outputs"
 	"github.com/grem11n/cost-exporter/probes"
+	"github.com/grem11n/cost-exporter/store"
 	"github.com/spf13/viper"
 )
 
 const (
-	defaultConfigPath = "./config.yaml"
+	defaultConfigPath    = "./config.yaml"
+	defaultMetricsFormat = "prometheus"
 )
 
 var (
@@ -21,10 +24,16 @@ var (
 )
 
 type Config struct {
-	Clients       map[string]clients.ClientConfig `mapstructure:"clients"`
-	MetricsFormat string                          `mapstructure:"metrics_format,omitempty"`
-	Outputs       map[string]outputs.OutputConfig `mapstructure:"outputs"`
-	Probes        probes.ProbeConfig              `mapstructure:"kubernetes_probes,omitempty"`
+	Clients map[string]clients.ClientConfig `mapstructure:"clients"`
+	// Converters subscribe to the clients' namespaces
+	Converters map[string]converters.ConverterConfig `mapstructure:"converters,omitempty"`
+	// MetricsFormat is kept for backwards compatibility.
+	// It is used only if no converters are configured
+	MetricsFormat string `mapstructure:"metrics_format,omitempty"`
+	// Outputs subscribe to the converters
+	Outputs map[string]outputs.OutputConfig `mapstructure:"outputs"`
+	Probes  probes.ProbeConfig              `mapstructure:"kubernetes_probes,omitempty"`
+	Store   store.Config                    `mapstructure:"store,omitempty"`
 }
 
 func New(configPath string) (*Config, error) {
@@ -57,6 +66,14 @@ func (c *Config) populateDefaults() error {
 		return ErrClientConfig
 	}
 
+	if c.MetricsFormat == "" {
+		c.MetricsFormat = defaultMetricsFormat
+	}
+	if c.Converters == nil {
+		c.Converters = make(map[string]converters.ConverterConfig)
+		c.Converters[c.MetricsFormat] = nil
+	}
+
 	if c.Outputs == nil {
 		c.Outputs = make(map[string]outputs.OutputConfig)
 		c.Outputs["http"] = outputs.HTTP{}
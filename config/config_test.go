@@ -3,6 +3,7 @@ package config
 import (
 	"testing"
 
+	"github.com/grem11n/cost-exporter/clients"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,3 +12,10 @@ func TestEmptyConfig(t *testing.T) {
 	err := emptyCfg.populateDefaults()
 	assert.ErrorIs(t, err, ErrClientConfig)
 }
+
+func TestDefaultConverters(t *testing.T) {
+	cfg := &Config{Clients: map[string]clients.ClientConfig{"aws": nil}}
+	assert.NoError(t, cfg.populateDefaults())
+	assert.Contains(t, cfg.Converters, defaultMetricsFormat)
+	assert.Contains(t, cfg.Outputs, "http")
+}
@@ -0,0 +1,110 @@
+package converters
+
+import (
+	"bytes"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
+)
+
+// Influx converts the metrics to the InfluxDB line protocol.
+// Each metric is a point of the measurement named after the metric
+// with its tags, the `value` field and the start of the cost bucket as the timestamp in seconds.
+// The period and estimated labels are fields, since they change when the bucket is refreshed,
+// e.g. the end of the current month bucket. So each refresh overwrites the point of the same series
+type Influx struct{}
+
+const (
+	InfluxName                   = "influx"
+	influxCostMetricsCounterName = "cost_exporter_cost_metrics_total{job=\"cost-exporter\",converter=\"influx\"}"
+	influxUnitTag                = "unit"
+)
+
+// influxFields are the labels written as fields in this order
+var influxFields = []string{intmetrics.PeriodStartLabel, intmetrics.PeriodEndLabel, intmetrics.EstimatedLabel}
+
+var (
+	influxCostMetricsCounter *metrics.Counter
+
+	// https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/#special-characters
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	fieldValueEscaper  = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+func init() {
+	logger.Info("Initializing InfluxDB line protocol converter")
+	Register(InfluxName, func(ConverterConfig) Converter { return &Influx{} })
+	influxCostMetricsCounter = intmetrics.InternalMetricsSet.GetOrCreateCounter(influxCostMetricsCounterName)
+}
+
+// Convert the metrics from the namespaces to the line protocol on every change
+func (i *Influx) Convert(st *store.Store, sub Subscription) {
+	logger.Info("Converting metrics to the InfluxDB line protocol from: ", sub.Namespaces)
+	watch(InfluxName, st, sub, func() { i.convert(st, sub.Namespaces) })
+}
+
+func (i *Influx) convert(st *store.Store, namespaces []string) {
+	snapshot := st.Snapshot(namespaces...)
+	var res bytes.Buffer
+	for _, m := range snapshot {
+		res.WriteString(Line(m))
+		res.WriteByte('\n')
+	}
+	logger.Debug("Writing InfluxDB metrics to the store with key: ", InfluxName)
+	st.PutPayload(InfluxName, res.Bytes())
+	influxCostMetricsCounter.Set(uint64(len(snapshot)))
+}
+
+// Line returns the metric as a point in the line protocol.
+// Points of the metrics without a period have no timestamp, so InfluxDB uses the write time
+func Line(m intmetrics.Metric) string {
+	tags := make([]string, 0, len(m.Tags)+1)
+	for k, v := range m.Tags {
+		// Empty tag values are not allowed
+		if v == "" || slices.Contains(influxFields, k) {
+			continue
+		}
+		tags = append(tags, tagEscaper.Replace(intmetrics.SanitizeName(k))+"="+tagEscaper.Replace(v))
+	}
+	if _, ok := m.Tags[influxUnitTag]; !ok && m.Unit != "" {
+		tags = append(tags, influxUnitTag+"="+tagEscaper.Replace(m.Unit))
+	}
+	// InfluxDB performs best with the tags sorted by key
+	sort.Strings(tags)
+
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(m.FullName()))
+	for _, tag := range tags {
+		b.WriteByte(',')
+		b.WriteString(tag)
+	}
+	b.WriteString(" value=")
+	b.WriteString(strconv.FormatFloat(m.Value, 'g', -1, 64))
+	for _, k := range influxFields {
+		v, ok := m.Tags[k]
+		if !ok || v == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(k)
+		b.WriteByte('=')
+		// Estimated is a boolean field
+		if k == intmetrics.EstimatedLabel && (v == "true" || v == "false") {
+			b.WriteString(v)
+			continue
+		}
+		b.WriteString(`"` + fieldValueEscaper.Replace(v) + `"`)
+	}
+	if start, ok := m.Period(intmetrics.PeriodStartLabel); ok {
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(start.Unix(), 10))
+	}
+	return b.String()
+}
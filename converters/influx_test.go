@@ -0,0 +1,74 @@
+package converters
+
+import (
+	"strings"
+	"testing"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfluxConvert(t *testing.T) {
+	st := store.New(store.Config{})
+	st.Put("aws", "payer/daily", []intmetrics.Metric{
+		{
+			Name:   "UnblendedCost",
+			Prefix: "aws_ce",
+			Unit:   "USD",
+			Value:  1.5,
+			Tags: map[string]string{
+				"service":                   "EC2 - Other",
+				intmetrics.PeriodStartLabel: "2024-10-01",
+				intmetrics.PeriodEndLabel:   "2024-10-02",
+			},
+		},
+	})
+	(&Influx{}).convert(st, []string{"aws"})
+
+	got, ok := st.Payload(InfluxName)
+	assert.True(t, ok)
+	assert.Equal(t,
+		`aws_ce_unblended_cost,job=cost-exporter,service=EC2\ -\ Other,unit=USD value=1.5,period_start="2024-10-01",period_end="2024-10-02" 1727740800`+"\n",
+		string(got))
+}
+
+func TestInfluxConvertRefresh(t *testing.T) {
+	st := store.New(store.Config{})
+	bucket := func(value float64, end, estimated string) []intmetrics.Metric {
+		return []intmetrics.Metric{{
+			Name:   "UnblendedCost",
+			Prefix: "aws_ce",
+			Value:  value,
+			Tags: map[string]string{
+				intmetrics.PeriodStartLabel: "2024-10-01",
+				intmetrics.PeriodEndLabel:   end,
+				intmetrics.EstimatedLabel:   estimated,
+			},
+		}}
+	}
+	lines := []string{}
+	// The month to date bucket grows and becomes final
+	for _, metrics := range [][]intmetrics.Metric{bucket(10, "2024-10-15", "true"), bucket(20, "2024-11-01", "false")} {
+		st.Put("aws", "payer/monthly", metrics)
+		(&Influx{}).convert(st, []string{"aws"})
+		got, _ := st.Payload(InfluxName) //nolint:errcheck
+		lines = append(lines, strings.TrimSpace(string(got)))
+	}
+	assert.Equal(t, `aws_ce_unblended_cost,job=cost-exporter value=10,period_start="2024-10-01",period_end="2024-10-15",estimated=true 1727740800`, lines[0])
+	assert.Equal(t, `aws_ce_unblended_cost,job=cost-exporter value=20,period_start="2024-10-01",period_end="2024-11-01",estimated=false 1727740800`, lines[1])
+	// The same series and timestamp, so InfluxDB overwrites the point
+	series := func(line string) string { return strings.SplitN(line, " ", 2)[0] }
+	assert.Equal(t, series(lines[0]), series(lines[1]))
+}
+
+func TestLine(t *testing.T) {
+	m := intmetrics.Metric{
+		Name:   "UsageQuantity",
+		Prefix: "aws_ce",
+		Unit:   "Hrs",
+		Value:  24,
+		Tags:   map[string]string{"usage_type": "a=b,c", "team": ""},
+	}
+	assert.Equal(t, `aws_ce_usage_quantity_hours,unit=Hrs,usage_type=a\=b\,c value=24`, Line(m))
+}
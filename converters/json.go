@@ -0,0 +1,94 @@
+package converters
+
+import (
+	"encoding/json"
+	"maps"
+
+	"github.com/VictoriaMetrics/metrics"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
+)
+
+// JSON converts the metrics to a JSON array of Documents
+type JSON struct{}
+
+// Document is a metric in the JSON format.
+// Query, period and estimated labels are moved to the dedicated fields.
+// The job label is the same for all the documents, so it is dropped
+type Document struct {
+	Metric    string            `json:"metric"`
+	Query     string            `json:"query,omitempty"`
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+	Unit      string            `json:"unit,omitempty"`
+	Period    *Period           `json:"period,omitempty"`
+	Estimated bool              `json:"estimated"`
+}
+
+// Period of the cost bucket as reported by the client
+type Period struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+const (
+	JSONName                   = "json"
+	jsonCostMetricsCounterName = "cost_exporter_cost_metrics_total{job=\"cost-exporter\",converter=\"json\"}"
+)
+
+var (
+	jsonCostMetricsCounter *metrics.Counter
+)
+
+func init() {
+	logger.Info("Initializing JSON converter")
+	Register(JSONName, func(ConverterConfig) Converter { return &JSON{} })
+	jsonCostMetricsCounter = intmetrics.InternalMetricsSet.GetOrCreateCounter(jsonCostMetricsCounterName)
+}
+
+// Convert the metrics from the namespaces to JSON on every change
+func (j *JSON) Convert(st *store.Store, sub Subscription) {
+	logger.Info("Converting metrics to JSON from: ", sub.Namespaces)
+	watch(JSONName, st, sub, func() { j.convert(st, sub.Namespaces) })
+}
+
+func (j *JSON) convert(st *store.Store, namespaces []string) {
+	snapshot := st.Snapshot(namespaces...)
+	docs := make([]Document, 0, len(snapshot))
+	for _, m := range snapshot {
+		docs = append(docs, NewDocument(m))
+	}
+	res, err := json.Marshal(docs)
+	if err != nil {
+		logger.Error("Cannot convert metrics to JSON: ", err)
+		return
+	}
+	logger.Debug("Writing JSON metrics to the store with key: ", JSONName)
+	st.PutPayload(JSONName, res)
+	jsonCostMetricsCounter.Set(uint64(len(docs)))
+}
+
+// NewDocument converts the metric into a Document
+func NewDocument(m intmetrics.Metric) Document {
+	labels := maps.Clone(m.Tags)
+	doc := Document{
+		Metric:    m.FullName(),
+		Query:     m.Query,
+		Labels:    labels,
+		Value:     m.Value,
+		Unit:      m.Unit,
+		Estimated: labels[intmetrics.EstimatedLabel] == "true",
+	}
+	start, hasStart := labels[intmetrics.PeriodStartLabel]
+	end, hasEnd := labels[intmetrics.PeriodEndLabel]
+	if hasStart || hasEnd {
+		doc.Period = &Period{Start: start, End: end}
+	}
+	delete(labels, intmetrics.PeriodStartLabel)
+	delete(labels, intmetrics.PeriodEndLabel)
+	delete(labels, intmetrics.EstimatedLabel)
+	delete(labels, "query")
+	delete(labels, "job")
+	return doc
+}
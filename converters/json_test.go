@@ -0,0 +1,52 @@
+package converters
+
+import (
+	"encoding/json"
+	"testing"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDocument(t *testing.T) {
+	doc := NewDocument(intmetrics.Metric{
+		Name:   "UnblendedCost",
+		Prefix: "aws_ce",
+		Query:  "daily",
+		Unit:   "USD",
+		Value:  1.5,
+		Tags: map[string]string{
+			"service":                   "S3",
+			"query":                     "daily",
+			"job":                       "cost-exporter",
+			intmetrics.PeriodStartLabel: "2024-10-01",
+			intmetrics.PeriodEndLabel:   "2024-10-02",
+			intmetrics.EstimatedLabel:   "true",
+		},
+	})
+	assert.Equal(t, Document{
+		Metric:    "aws_ce_unblended_cost",
+		Query:     "daily",
+		Labels:    map[string]string{"service": "S3"},
+		Value:     1.5,
+		Unit:      "USD",
+		Period:    &Period{Start: "2024-10-01", End: "2024-10-02"},
+		Estimated: true,
+	}, doc)
+	assert.Nil(t, NewDocument(intmetrics.Metric{Tags: map[string]string{}}).Period)
+}
+
+func TestJSONConvert(t *testing.T) {
+	st := store.New(store.Config{})
+	st.Put("aws", "payer/daily", []intmetrics.Metric{testMetric})
+	(&JSON{}).convert(st, []string{"aws"})
+
+	got, ok := st.Payload(JSONName)
+	assert.True(t, ok)
+	var docs []Document
+	assert.NoError(t, json.Unmarshal(got, &docs))
+	assert.Len(t, docs, 1)
+	assert.Equal(t, "aws_ce_test", docs[0].Metric)
+	assert.Equal(t, "bar", docs[0].Labels["foo"])
+}
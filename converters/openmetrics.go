@@ -0,0 +1,71 @@
+package converters
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/internal/openmetrics"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
+)
+
+// OpenMetrics converts the metrics to the OpenMetrics format
+// with HELP, TYPE and UNIT metadata and the end of the cost bucket as the timestamp.
+// The payload has no `# EOF` marker, so outputs can append more metrics.
+// The metrics are also put in the classic text format for the scrapers,
+// which do not accept OpenMetrics, if the prometheus converter is not used
+type OpenMetrics struct{}
+
+const (
+	OpenMetricsName = "openmetrics"
+	// OpenMetricsTextName is a key of the classic text format fallback
+	OpenMetricsTextName               = "openmetrics-text"
+	openMetricsCostMetricsCounterName = "cost_exporter_cost_metrics_total{job=\"cost-exporter\",converter=\"openmetrics\"}"
+)
+
+var (
+	openMetricsCostMetricsCounter *metrics.Counter
+)
+
+func init() {
+	logger.Info("Initializing OpenMetrics converter")
+	Register(OpenMetricsName, func(ConverterConfig) Converter { return &OpenMetrics{} })
+	openMetricsCostMetricsCounter = intmetrics.InternalMetricsSet.GetOrCreateCounter(openMetricsCostMetricsCounterName)
+}
+
+// Convert the metrics from the namespaces to the OpenMetrics format on every change
+func (o *OpenMetrics) Convert(st *store.Store, sub Subscription) {
+	logger.Info("Converting metrics to the OpenMetrics format from: ", sub.Namespaces)
+	watch(OpenMetricsName, st, sub, func() { o.convert(st, sub.Namespaces, time.Now()) })
+}
+
+func (o *OpenMetrics) convert(st *store.Store, namespaces []string, now time.Time) {
+	snapshot := st.Snapshot(namespaces...)
+	text, _, err := (&Prometheus{}).text(snapshot)
+	if err != nil {
+		// Keep the last good payloads, so the OpenMetrics and the text ones are the same metrics
+		logger.Error("Cannot convert metrics to the classic text format: ", err)
+		return
+	}
+	var res bytes.Buffer
+	openmetrics.Write(&res, openmetrics.Group(snapshot, func(m intmetrics.Metric) time.Time {
+		return bucketEnd(m, now)
+	}))
+	logger.Debug("Writing OpenMetrics metrics to the store with key: ", OpenMetricsName)
+	st.PutPayload(OpenMetricsName, res.Bytes())
+	st.PutPayload(OpenMetricsTextName, text)
+	openMetricsCostMetricsCounter.Set(uint64(len(snapshot)))
+}
+
+// bucketEnd returns the end of the cost bucket the metric refers to.
+// Buckets of the current period end in the future, so they have no timestamp
+// and the scrapers use the scrape time. Metrics without a period have no timestamp either
+func bucketEnd(m intmetrics.Metric, now time.Time) time.Time {
+	end, ok := m.Period(intmetrics.PeriodEndLabel)
+	if !ok || end.After(now) {
+		return time.Time{}
+	}
+	return end
+}
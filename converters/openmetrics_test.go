@@ -0,0 +1,67 @@
+package converters
+
+import (
+	"testing"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMetricsConvert(t *testing.T) {
+	st := store.New(store.Config{})
+	st.Put("aws", "payer/daily", []intmetrics.Metric{
+		{
+			Name:   "UnblendedCost",
+			Prefix: "aws_ce",
+			Help:   "Daily cost per service",
+			Unit:   "USD",
+			Value:  1.5,
+			Tags: map[string]string{
+				"service":                   "S3",
+				intmetrics.PeriodStartLabel: "2024-10-01",
+				intmetrics.PeriodEndLabel:   "2024-10-02",
+			},
+		},
+	})
+	(&OpenMetrics{}).convert(st, []string{"aws"}, time.Date(2024, 10, 15, 0, 0, 0, 0, time.UTC))
+
+	got, ok := st.Payload(OpenMetricsName)
+	assert.True(t, ok)
+	assert.Equal(t, `# TYPE aws_ce_unblended_cost gauge
+# HELP aws_ce_unblended_cost Daily cost per service
+aws_ce_unblended_cost{job="cost-exporter",period_end="2024-10-02",period_start="2024-10-01",service="S3"} 1.5 1727827200
+`, string(got))
+
+	// The classic text format fallback
+	got, ok = st.Payload(OpenMetricsTextName)
+	assert.True(t, ok)
+	assert.Equal(t, `aws_ce_unblended_cost{job="cost-exporter",period_end="2024-10-02",period_start="2024-10-01",service="S3"} 1.5
+`, string(got))
+}
+
+func TestOpenMetricsConvertInvalid(t *testing.T) {
+	now := time.Date(2024, 10, 15, 0, 0, 0, 0, time.UTC)
+	st := store.New(store.Config{})
+	st.Put("aws", "valid", []intmetrics.Metric{{Name: "UnblendedCost", Value: 1}})
+	(&OpenMetrics{}).convert(st, []string{"aws"}, now)
+	want, ok := st.Payload(OpenMetricsTextName)
+	assert.True(t, ok)
+
+	// The classic text fallback is not overwritten with a partial payload
+	st.Put("aws", "invalid", []intmetrics.Metric{{Name: "UnblendedCost", Tags: map[string]string{"": "empty"}}})
+	(&OpenMetrics{}).convert(st, []string{"aws"}, now)
+	got, ok := st.Payload(OpenMetricsTextName)
+	assert.True(t, ok)
+	assert.Equal(t, want, got)
+}
+
+func TestBucketEnd(t *testing.T) {
+	now := time.Date(2024, 10, 15, 12, 0, 0, 0, time.UTC)
+	m := intmetrics.Metric{Tags: map[string]string{intmetrics.PeriodEndLabel: "2024-10-02"}}
+	assert.Equal(t, time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC), bucketEnd(m, now))
+	m.Tags[intmetrics.PeriodEndLabel] = "2024-10-16"
+	assert.True(t, bucketEnd(m, now).IsZero())
+	assert.True(t, bucketEnd(intmetrics.Metric{Tags: map[string]string{}}, now).IsZero())
+}
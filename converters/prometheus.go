@@ -2,100 +2,83 @@ package converters
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
-	"github.com/ettle/strcase"
 	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
 	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
 )
 
 type Prometheus struct{}
 
 const (
-	namespace = "prometheus"
-	// We do not need to convert metrics too frequently,
-	// since they are propagated hourly
-	cooldown               = 30 // minutes
+	PrometheusName         = "prometheus"
 	costMetricsCounterName = "cost_exporter_cost_metrics_total{job=\"cost-exporter\",converter=\"prometheus\"}"
 	conversionDurationName = "cost_exporter_prometheus_aws_conversion_duration{job=\"cost-exporter\"}"
 )
 
 var (
+	ErrConversion = errors.New("conversion failed")
+
 	costMetricsCounter *metrics.Counter
 	conversionDuration *metrics.Histogram
 )
 
 func init() {
 	logger.Info("Initializing PrometheusAWS converter")
-	Register(namespace, func() Converter { return &Prometheus{} })
+	Register(PrometheusName, func(ConverterConfig) Converter { return &Prometheus{} })
 	// Maybe initiate all the metrics in a loop if there are too many
 	logger.Info("Initializing PrometheusAWS converter metrics")
 	costMetricsCounter = intmetrics.InternalMetricsSet.GetOrCreateCounter(costMetricsCounterName)
 	conversionDuration = intmetrics.InternalMetricsSet.GetOrCreateHistogram(conversionDurationName)
 }
 
-func (p *Prometheus) Convert(cache *sync.Map, fetchPrefix string) {
-	logger.Info("Converting AWS metrics to the Prometheus format")
-	for {
-		if ok := p.convert(cache, fetchPrefix); ok {
-			time.Sleep(cooldown * time.Minute)
-		}
-	}
+// Convert the metrics from the namespaces to the Prometheus format on every change
+func (p *Prometheus) Convert(st *store.Store, sub Subscription) {
+	logger.Info("Converting metrics to the Prometheus format from: ", sub.Namespaces)
+	watch(PrometheusName, st, sub, func() { p.convert(st, sub.Namespaces) })
 }
 
-func (p *Prometheus) convert(cache *sync.Map, fetchPrefix string) bool {
+func (p *Prometheus) convert(st *store.Store, namespaces []string) {
 	startTs := time.Now()
-	vm := metrics.NewSet()
-	cache.Range(func(key, value any) bool {
-		ks, ok := key.(string)
-		if !ok {
-			logger.Error("cache key is not a string, got %T", key)
-			// Return on this iteration, but continue the loop
-			return true
-		}
-		if strings.HasPrefix(ks, fetchPrefix) {
-			metric, ok := value.(intmetrics.Metric)
-			if !ok {
-				logger.Warn("wrong metric type found in %s: %T", fetchPrefix, value)
-			}
-			p.createVMetric(vm, metric)
-		}
-		return true
-	})
-
-	// Handle the case when the metrics are not yet present
-	if len(vm.ListMetricNames()) == 0 {
-		return false
+	res, count, err := p.text(st.Snapshot(namespaces...))
+	if err != nil {
+		// Keep the last good payload
+		logger.Error("Cannot convert metrics to the Prometheus format: ", err)
+		return
 	}
+	logger.Debug("Writing Prometheus metrics to the store with key: ", PrometheusName)
+	st.PutPayload(PrometheusName, res)
+	logger.Debug("Prometheus metrics: ", string(res))
 
-	var res bytes.Buffer
-	vm.WritePrometheus(&res)
-	logger.Debug("Writing Prometheus metrics to cache with key: ", namespace)
-	cache.Swap(namespace, res.Bytes())
-	logger.Debug("Prometheus metrics: ", res.String())
-
-	costMetricsCounter.Set(uint64(len(vm.ListMetricNames())))
+	costMetricsCounter.Set(uint64(count))
 	conversionDuration.UpdateDuration(startTs)
-	return true
+}
+
+// text returns the metrics in the classic text format and the number of the series.
+// The metrics set panics on invalid names, e.g. with an empty label name, so the panic is returned as an error
+func (p *Prometheus) text(snapshot []intmetrics.Metric) (res []byte, count int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrConversion, r)
+		}
+	}()
+	vm := metrics.NewSet()
+	for _, metric := range snapshot {
+		p.createVMetric(vm, metric)
+	}
+	var buf bytes.Buffer
+	vm.WritePrometheus(&buf)
+	return buf.Bytes(), len(vm.ListMetricNames()), nil
 }
 
 func (p *Prometheus) createVMetric(vm *metrics.Set, metric intmetrics.Metric) {
 	logger.Debug("Got metric: ", metric)
-	var tags []string
-	for k, v := range metric.Tags {
-		tags = append(tags, fmt.Sprintf("%s=\"%s\"", k, v))
-	}
-	tagStr := strings.Join(tags, ",")
-	metricName := fmt.Sprintf(
-		"%s_%s{%s}",
-		strcase.ToSnake(metric.Prefix),
-		strcase.ToSnake(metric.Name),
-		tagStr,
-	)
+	metricName := fmt.Sprintf("%s{%s}", metric.FullName(), strings.Join(metric.LabelPairs(), ","))
 	vm.GetOrCreateGauge(metricName, func() float64 {
 		return metric.Value
 	})
@@ -1,11 +1,11 @@
 package converters
 
 import (
-	"sync"
 	"testing"
 
 	"github.com/VictoriaMetrics/metrics"
 	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/store"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,7 +17,6 @@ var (
 		Tags:   map[string]string{"foo": "bar"},
 		Value:  0.27,
 	}
-	testCache = sync.Map{}
 )
 
 func TestCreateVMetric(t *testing.T) {
@@ -27,17 +26,71 @@ func TestCreateVMetric(t *testing.T) {
 }
 
 func TestConvert(t *testing.T) {
-	testCache.Clear()
-	ns := "test"
-	testCache.Store(ns, testMetric)
+	st := store.New(store.Config{})
+	st.Put("test", "query", []intmetrics.Metric{testMetric})
+	// Metrics of other namespaces are not converted
+	st.Put("other", "query", []intmetrics.Metric{{Name: "other", Prefix: "other"}})
 
-	ok := testProm.convert(&testCache, ns)
+	testProm.convert(st, []string{"test"})
+
+	got, ok := st.Payload(PrometheusName)
+	assert.True(t, ok)
+	assert.Equal(t, "aws_ce_test{foo=\"bar\",job=\"cost-exporter\"} 0.27\n", string(got))
+}
+
+func TestCreateVMetricSanitize(t *testing.T) {
+	vm := metrics.NewSet()
+	m := intmetrics.Metric{
+		Name:   "UnblendedCost",
+		Prefix: "aws_ce",
+		Tags: map[string]string{
+			"tag_aws:createdBy": "arn:aws:iam::111111111111:user/\"bob\"",
+			"service":           "Amazon\\S3\nStorage",
+		},
+		Value: 1,
+	}
+	assert.NotPanics(t, func() { testProm.createVMetric(vm, m) })
+	assert.Equal(t, []string{
+		`aws_ce_unblended_cost{service="Amazon\\S3\nStorage",tag_aws_createdBy="arn:aws:iam::111111111111:user/\"bob\""}`,
+	}, vm.ListMetricNames())
+}
+
+func TestCreateVMetricUnits(t *testing.T) {
+	vm := metrics.NewSet()
+	for _, m := range []intmetrics.Metric{
+		{Name: "UnblendedCost", Prefix: "aws_ce", Unit: "USD", Tags: map[string]string{"query": "mixed"}},
+		{Name: "UsageQuantity", Prefix: "aws_ce", Unit: "Hrs", Tags: map[string]string{"query": "mixed"}},
+		{Name: "UsageQuantity", Prefix: "aws_ce", Unit: "GB-Mo", Tags: map[string]string{"query": "mixed"}},
+	} {
+		testProm.createVMetric(vm, m)
+	}
+	assert.ElementsMatch(t, []string{
+		`aws_ce_unblended_cost{query="mixed"}`,
+		`aws_ce_usage_quantity_hours{query="mixed"}`,
+		`aws_ce_usage_quantity_gigabyte_months{query="mixed"}`,
+	}, vm.ListMetricNames())
+}
+
+func TestConvertEmpty(t *testing.T) {
+	// Evicted metrics disappear from the output
+	st := store.New(store.Config{})
+	testProm.convert(st, []string{"test"})
+	got, ok := st.Payload(PrometheusName)
 	assert.True(t, ok)
+	assert.Empty(t, got)
+}
 
-	got, ok := testCache.Load(namespace)
+func TestConvertInvalid(t *testing.T) {
+	st := store.New(store.Config{})
+	st.Put("test", "valid", []intmetrics.Metric{{Name: "UnblendedCost", Value: 1}})
+	testProm.convert(st, []string{"test"})
+	want, ok := st.Payload(PrometheusName)
 	assert.True(t, ok)
 
-	gotB, ok := got.([]byte)
+	// The last good payload is kept
+	st.Put("test", "invalid", []intmetrics.Metric{{Name: "UnblendedCost", Tags: map[string]string{"": "empty"}}})
+	testProm.convert(st, []string{"test"})
+	got, ok := st.Payload(PrometheusName)
 	assert.True(t, ok)
-	assert.Equal(t, "aws_ce_test{foo=\"bar\"} 0.27\n", string(gotB))
+	assert.Equal(t, want, got)
 }
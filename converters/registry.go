@@ -1,12 +1,33 @@
 package converters
 
-import "sync"
+import (
+	"time"
 
+	"github.com/grem11n/cost-exporter/store"
+)
+
+// ConverterConfig contains the config for each Converter
+type ConverterConfig any
+
+// Subscription is a part of the converter config shared by all the converters
+type Subscription struct {
+	// Store namespaces of the clients to convert the metrics from.
+	// Metrics from all the clients are converted if empty
+	Namespaces []string `mapstructure:"namespaces,omitempty"`
+	// Debounce waits until there are no changes for this period before the conversion,
+	// e.g. when several queries are refreshed one after another
+	Debounce time.Duration `mapstructure:"debounce,omitempty"`
+	// Once converts the metrics a single time and returns, e.g. in the one-shot run mode
+	Once bool `mapstructure:"-"`
+}
+
+// Converter converts the metrics from the subscribed namespaces on every change
+// and writes the result to the store under the converter name
 type Converter interface {
-	Convert(*sync.Map, string)
+	Convert(*store.Store, Subscription)
 }
 
-type ConverterFactory func() Converter
+type ConverterFactory func(ConverterConfig) Converter
 
 var converterRegistry = make(map[string]ConverterFactory)
 
@@ -0,0 +1,53 @@
+package converters
+
+import (
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/internal/remotewrite"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
+)
+
+// RemoteWrite converts the metrics to a Prometheus remote write request.
+// Series have the same names and labels as in the Prometheus format.
+// Each sample gets the end of its cost bucket as the timestamp like in the OpenMetrics format.
+// The payload is the uncompressed protobuf WriteRequest
+type RemoteWrite struct{}
+
+const (
+	RemoteWriteName                   = "remote_write"
+	remoteWriteCostMetricsCounterName = "cost_exporter_cost_metrics_total{job=\"cost-exporter\",converter=\"remote_write\"}"
+)
+
+var (
+	remoteWriteCostMetricsCounter *metrics.Counter
+)
+
+func init() {
+	logger.Info("Initializing remote write converter")
+	Register(RemoteWriteName, func(ConverterConfig) Converter { return &RemoteWrite{} })
+	remoteWriteCostMetricsCounter = intmetrics.InternalMetricsSet.GetOrCreateCounter(remoteWriteCostMetricsCounterName)
+}
+
+// Convert the metrics from the namespaces to a remote write request on every change
+func (r *RemoteWrite) Convert(st *store.Store, sub Subscription) {
+	logger.Info("Converting metrics to remote write requests from: ", sub.Namespaces)
+	watch(RemoteWriteName, st, sub, func() { r.convert(st, sub.Namespaces, time.Now()) })
+}
+
+func (r *RemoteWrite) convert(st *store.Store, namespaces []string, now time.Time) {
+	snapshot := st.Snapshot(namespaces...)
+	for i := range snapshot {
+		snapshot[i].Timestamp = bucketEnd(snapshot[i], now)
+		// Open buckets and metrics without a period are reported as of now.
+		// So are the estimated buckets, since the receivers reject new values of the existing samples
+		if snapshot[i].Timestamp.IsZero() || snapshot[i].Tags[intmetrics.EstimatedLabel] == "true" {
+			snapshot[i].Timestamp = now
+		}
+	}
+	logger.Debug("Writing remote write request to the store with key: ", RemoteWriteName)
+	st.PutPayload(RemoteWriteName, remotewrite.Marshal(remotewrite.FromMetrics(snapshot)))
+	remoteWriteCostMetricsCounter.Set(uint64(len(snapshot)))
+}
@@ -0,0 +1,64 @@
+package converters
+
+import (
+	"testing"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/internal/remotewrite"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteWriteConvert(t *testing.T) {
+	now := time.Date(2024, 10, 15, 12, 0, 0, 0, time.UTC)
+	st := store.New(store.Config{})
+	st.Put("aws", "payer/daily", []intmetrics.Metric{
+		{
+			Name:   "UnblendedCost",
+			Prefix: "aws_ce",
+			Value:  1.5,
+			Tags: map[string]string{
+				"service":                   "S3",
+				intmetrics.PeriodStartLabel: "2024-10-01",
+				intmetrics.PeriodEndLabel:   "2024-10-02",
+			},
+		},
+		{Name: "UnblendedCost", Prefix: "aws_ce", Value: 42, Tags: map[string]string{"service": "EC2"}},
+		{
+			Name:   "UnblendedCost",
+			Prefix: "aws_ce",
+			Value:  7,
+			Tags: map[string]string{
+				"service":                   "S3",
+				intmetrics.PeriodStartLabel: "2024-10-14",
+				intmetrics.PeriodEndLabel:   "2024-10-15",
+				intmetrics.EstimatedLabel:   "true",
+			},
+		},
+	})
+	(&RemoteWrite{}).convert(st, []string{"aws"}, now)
+
+	got, ok := st.Payload(RemoteWriteName)
+	assert.True(t, ok)
+	assert.Equal(t, remotewrite.Marshal([]remotewrite.TimeSeries{
+		remotewrite.NewTimeSeries("aws_ce_unblended_cost", map[string]string{
+			"job":                       "cost-exporter",
+			"service":                   "S3",
+			intmetrics.PeriodStartLabel: "2024-10-01",
+			intmetrics.PeriodEndLabel:   "2024-10-02",
+		}, remotewrite.Sample{Value: 1.5, Timestamp: time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC).UnixMilli()}),
+		remotewrite.NewTimeSeries("aws_ce_unblended_cost", map[string]string{
+			"job":     "cost-exporter",
+			"service": "EC2",
+		}, remotewrite.Sample{Value: 42, Timestamp: now.UnixMilli()}),
+		// Estimated buckets may be revised, so each revision is a new sample
+		remotewrite.NewTimeSeries("aws_ce_unblended_cost", map[string]string{
+			"job":                       "cost-exporter",
+			"service":                   "S3",
+			intmetrics.PeriodStartLabel: "2024-10-14",
+			intmetrics.PeriodEndLabel:   "2024-10-15",
+			intmetrics.EstimatedLabel:   "true",
+		}, remotewrite.Sample{Value: 7, Timestamp: now.UnixMilli()}),
+	}), got)
+}
@@ -0,0 +1,70 @@
+package converters
+
+import (
+	"fmt"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	conversionLatencyName = "cost_exporter_conversion_latency_seconds{job=\"cost-exporter\",converter=%q}"
+)
+
+// DecodeSubscription decodes the part of the converter config shared by all the converters
+func DecodeSubscription(cfg ConverterConfig) (Subscription, error) {
+	var sub Subscription
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     &sub,
+	})
+	if err != nil {
+		return sub, err
+	}
+	return sub, decoder.Decode(cfg)
+}
+
+// watch calls convert when the metrics in the subscribed namespaces change.
+// With the debounce, the conversion waits until there are no changes for the debounce period,
+// so a burst of changes is converted at once.
+// Conversion latency is the time from the last store update to the converted metrics
+// without the debounce period.
+// With sub.Once, the metrics are converted right away and watch returns
+func watch(name string, st *store.Store, sub Subscription, convert func()) {
+	if sub.Once {
+		convert()
+		return
+	}
+	latency := intmetrics.InternalMetricsSet.GetOrCreateHistogram(fmt.Sprintf(conversionLatencyName, name))
+	events := st.Subscribe(sub.Namespaces...)
+	// The clients may have put the metrics before the subscription
+	if st.Count(sub.Namespaces...) > 0 {
+		convert()
+	}
+	var (
+		last    store.Event
+		pending <-chan time.Time
+	)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			last = event
+			if sub.Debounce <= 0 {
+				convert()
+				latency.Update(time.Since(last.Time).Seconds())
+				continue
+			}
+			// Every change postpones the conversion
+			pending = time.After(sub.Debounce)
+		case <-pending:
+			pending = nil
+			convert()
+			latency.Update((time.Since(last.Time) - sub.Debounce).Seconds())
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package converters
+
+import (
+	"testing"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSubscription(t *testing.T) {
+	sub, err := DecodeSubscription(map[string]any{"namespaces": []string{"aws"}, "debounce": "5s"})
+	assert.NoError(t, err)
+	assert.Equal(t, Subscription{Namespaces: []string{"aws"}, Debounce: 5 * time.Second}, sub)
+
+	sub, err = DecodeSubscription(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, sub.Namespaces)
+}
+
+func TestWatch(t *testing.T) {
+	st := store.New(store.Config{})
+	// Metrics put before the subscription are converted on start
+	st.Put("aws", "payer/daily", []intmetrics.Metric{testMetric})
+	converted := make(chan struct{}, 10)
+	go watch("test", st, Subscription{Namespaces: []string{"aws"}}, func() { converted <- struct{}{} })
+
+	waitConverted(t, converted)
+	st.Put("gcp", "billing", []intmetrics.Metric{testMetric})
+	st.Put("aws", "payer/monthly", []intmetrics.Metric{testMetric})
+	waitConverted(t, converted)
+}
+
+func TestWatchDebounce(t *testing.T) {
+	st := store.New(store.Config{})
+	converted := make(chan struct{}, 10)
+	go watch("test_debounce", st, Subscription{Debounce: 50 * time.Millisecond}, func() { converted <- struct{}{} })
+
+	// Give the watcher time to subscribe
+	time.Sleep(10 * time.Millisecond)
+	// The changes keep coming for longer than the debounce period
+	for range 5 {
+		st.Put("aws", "payer/daily", []intmetrics.Metric{testMetric})
+		time.Sleep(20 * time.Millisecond)
+	}
+	// The conversion waits for the quiet period after the last change
+	assert.Empty(t, converted)
+	waitConverted(t, converted)
+	time.Sleep(100 * time.Millisecond)
+	// All the changes are converted at once
+	assert.Empty(t, converted)
+}
+
+func waitConverted(t *testing.T, converted chan struct{}) {
+	t.Helper()
+	select {
+	case <-converted:
+	case <-time.After(time.Second):
+		t.Fatal("metrics were not converted")
+	}
+}
+
+func TestWatchOnce(t *testing.T) {
+	st := store.New(store.Config{})
+	calls := 0
+	// Returns right away even if the store is empty
+	watch("test_once", st, Subscription{Once: true}, func() { calls++ })
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,53 @@
+/*
+This package implements the sinks for the historical metrics
+fetched by the `backfill` command
+*/
+package backfill
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/internal/remotewrite"
+)
+
+// Supported sinks
+const (
+	SinkOpenMetrics = "openmetrics"
+	SinkRemoteWrite = "remote_write"
+)
+
+var (
+	ErrSink = errors.New("unsupported backfill sink")
+)
+
+// Sink writes the metrics with their original timestamps
+type Sink interface {
+	Write(metrics []intmetrics.Metric) error
+	// Close flushes the buffered metrics
+	Close() error
+}
+
+// Config of the sink
+type Config struct {
+	Sink        string
+	Path        string
+	RemoteWrite remotewrite.Config
+}
+
+// New returns the sink by its name
+func New(cfg Config) (Sink, error) {
+	switch strings.ToLower(cfg.Sink) {
+	case SinkOpenMetrics:
+		return NewOpenMetrics(cfg.Path)
+	case SinkRemoteWrite:
+		if cfg.RemoteWrite.URL == "" {
+			return nil, fmt.Errorf("%w: remote write URL is required", ErrSink)
+		}
+		return NewRemoteWrite(remotewrite.NewClient(cfg.RemoteWrite)), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrSink, cfg.Sink)
+	}
+}
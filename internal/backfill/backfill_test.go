@@ -0,0 +1,78 @@
+package backfill
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/internal/remotewrite"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	day1 = time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	day2 = time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC)
+)
+
+func testMetrics() []intmetrics.Metric {
+	return []intmetrics.Metric{
+		{Name: "UnblendedCost", Prefix: "aws_ce", Help: "Daily cost", Value: 2, Timestamp: day2,
+			Tags: map[string]string{"service": "S3"}},
+		{Name: "UnblendedCost", Prefix: "aws_ce", Help: "Daily cost", Value: 1, Timestamp: day1,
+			Tags: map[string]string{"service": "S3"}},
+		{Name: "UsageQuantity", Prefix: "aws_ce", Unit: "Hrs", Value: 24, Timestamp: day1,
+			Tags: map[string]string{"service": "EC2"}},
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{Sink: "csv"})
+	assert.ErrorIs(t, err, ErrSink)
+	_, err = New(Config{Sink: SinkOpenMetrics})
+	assert.ErrorIs(t, err, ErrSink)
+	_, err = New(Config{Sink: SinkRemoteWrite})
+	assert.ErrorIs(t, err, ErrSink)
+}
+
+func TestOpenMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backfill.om")
+	sink, err := NewOpenMetrics(path)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Write(testMetrics()))
+	assert.NoError(t, sink.Close())
+
+	got, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `# TYPE aws_ce_unblended_cost gauge
+# HELP aws_ce_unblended_cost Daily cost
+aws_ce_unblended_cost{job="cost-exporter",service="S3"} 1 1727740800
+aws_ce_unblended_cost{job="cost-exporter",service="S3"} 2 1727827200
+# TYPE aws_ce_usage_quantity_hours gauge
+# UNIT aws_ce_usage_quantity_hours hours
+aws_ce_usage_quantity_hours{job="cost-exporter",service="EC2"} 24 1727740800
+# EOF
+`, string(got))
+}
+
+type fakeWriter struct {
+	series []remotewrite.TimeSeries
+}
+
+func (f *fakeWriter) Write(_ context.Context, series []remotewrite.TimeSeries) error {
+	f.series = append(f.series, series...)
+	return nil
+}
+
+func TestRemoteWrite(t *testing.T) {
+	w := &fakeWriter{}
+	assert.NoError(t, NewRemoteWrite(w).Write(testMetrics()))
+	assert.Len(t, w.series, 2)
+	assert.Equal(t, []remotewrite.Sample{
+		{Value: 1, Timestamp: day1.UnixMilli()},
+		{Value: 2, Timestamp: day2.UnixMilli()},
+	}, w.series[0].Samples)
+	assert.Equal(t, remotewrite.Label{Name: "__name__", Value: "aws_ce_unblended_cost"}, w.series[0].Labels[0])
+}
@@ -0,0 +1,56 @@
+package backfill
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/internal/openmetrics"
+)
+
+// OpenMetrics writes the metrics into a file in the OpenMetrics format,
+// which can be imported with `promtool tsdb create-blocks-from openmetrics`.
+// The samples of a metric family have to be contiguous,
+// so the metrics are buffered until the sink is closed
+type OpenMetrics struct {
+	path    string
+	metrics []intmetrics.Metric
+}
+
+func NewOpenMetrics(path string) (*OpenMetrics, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: output path is required", ErrSink)
+	}
+	return &OpenMetrics{path: path}, nil
+}
+
+func (o *OpenMetrics) Write(metrics []intmetrics.Metric) error {
+	for _, m := range metrics {
+		m.AddDefaultTags()
+		o.metrics = append(o.metrics, m)
+	}
+	return nil
+}
+
+// Close writes all the buffered metrics into the file
+func (o *OpenMetrics) Close() error {
+	file, err := os.Create(o.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	now := time.Now()
+	openmetrics.Write(w, openmetrics.Group(o.metrics, func(m intmetrics.Metric) time.Time {
+		if m.Timestamp.IsZero() {
+			return now
+		}
+		return m.Timestamp
+	}))
+	if _, err := w.WriteString(openmetrics.EOF); err != nil {
+		return err
+	}
+	return w.Flush()
+}
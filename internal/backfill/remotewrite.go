@@ -0,0 +1,39 @@
+package backfill
+
+import (
+	"context"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/internal/remotewrite"
+)
+
+type writer interface {
+	Write(ctx context.Context, series []remotewrite.TimeSeries) error
+}
+
+// RemoteWrite sends the metrics to a remote write endpoint.
+// The endpoint has to accept samples older than the head block,
+// e.g. Prometheus with out-of-order ingestion enabled, Mimir or VictoriaMetrics
+type RemoteWrite struct {
+	client writer
+}
+
+func NewRemoteWrite(client writer) *RemoteWrite {
+	return &RemoteWrite{client: client}
+}
+
+// Write groups the metrics into time series and sends them in batches
+func (r *RemoteWrite) Write(metrics []intmetrics.Metric) error {
+	series := remotewrite.FromMetrics(metrics)
+	for start := 0; start < len(series); start += remotewrite.DefaultBatchSize {
+		end := min(start+remotewrite.DefaultBatchSize, len(series))
+		if err := r.client.Write(context.TODO(), series[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RemoteWrite) Close() error {
+	return nil
+}
@@ -6,9 +6,6 @@ package metrics
 
 import (
 	"bytes"
-	"fmt"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
@@ -20,31 +17,42 @@ var (
 	}
 )
 
+// Labels set by the clients, which the converters rely on
+const (
+	PeriodStartLabel = "period_start" // start of the cost bucket
+	PeriodEndLabel   = "period_end"   // exclusive end of the cost bucket
+	EstimatedLabel   = "estimated"    // "true" if the cost bucket may still change
+)
+
 type Metric struct {
 	Value  float64
 	Name   string
 	Prefix string // is used to distinguish cloud clients
+	Query  string // name of the query that produced the metric
+	Help   string
+	Unit   string // as reported by the cloud provider, e.g. USD or Hrs
 	Tags   map[string]string
+	// Time of the sample, e.g. the start of the cost bucket when backfilling.
+	// Zero means the time of the export
+	Timestamp time.Time
 }
 
-func AddMetrics(cache *sync.Map, namespace string, metrics []Metric) {
-	for _, m := range metrics {
-		AddMetric(cache, namespace, m)
-	}
+// Period returns the time of the period label, e.g. PeriodEndLabel
+func (m *Metric) Period(label string) (time.Time, bool) {
+	t, err := ParsePeriod(m.Tags[label])
+	return t, err == nil
 }
 
-func AddMetric(cache *sync.Map, namespace string, metric Metric) {
-	metric.addDefaultTags()
-	tags := []string{}
-	for k := range metric.Tags {
-		tags = append(tags, k)
+// ParsePeriod parses both the dates and the timestamps of the cost buckets
+func ParsePeriod(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
 	}
-	tagsStr := strings.Join(tags, "_")
-	key := fmt.Sprintf("%s_%s_%s", namespace, metric.Name, tagsStr)
-	cache.Swap(key, metric)
+	return time.Parse("2006-01-02", s)
 }
 
-func (m *Metric) addDefaultTags() {
+// AddDefaultTags adds the tags shared by all the exported metrics, e.g. `job`
+func (m *Metric) AddDefaultTags() {
 	for k, v := range defaultTags {
 		m.Tags[k] = v
 	}
@@ -59,15 +67,26 @@ func init() {
 	InternalMetricsSet = metrics.NewSet()
 }
 
-// Publish metrics to the cache in the Prometheus format
-func Publish(key string, cache *sync.Map) {
+// PayloadWriter is a part of the store the internal metrics are published to
+type PayloadWriter interface {
+	PutPayload(key string, payload []byte)
+}
+
+// Publish metrics to the store in the Prometheus format
+func Publish(key string, store PayloadWriter) {
 	for {
-		publish(key, cache)
+		publish(key, store)
 		time.Sleep(cooldown * time.Second)
 	}
 }
-func publish(key string, cache *sync.Map) {
+
+// PublishOnce writes the current internal metrics to the store, e.g. in the one-shot run mode
+func PublishOnce(key string, store PayloadWriter) {
+	publish(key, store)
+}
+
+func publish(key string, store PayloadWriter) {
 	var res bytes.Buffer
 	InternalMetricsSet.WritePrometheus(&res)
-	cache.Swap(key, res.Bytes())
+	store.PutPayload(key, res.Bytes())
 }
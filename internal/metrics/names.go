@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ettle/strcase"
+)
+
+// FullName returns the Prometheus name of the metric:
+// the prefix and the name in snake case followed by the unit suffix
+func (m *Metric) FullName() string {
+	return fmt.Sprintf(
+		"%s_%s",
+		SanitizeName(strcase.ToSnake(m.Prefix)),
+		SanitizeName(NameWithUnit(strcase.ToSnake(m.Name), m.Unit)),
+	)
+}
+
+// LabelPairs returns the `name="value"` pairs of the metric tags
+// with sanitized names and escaped values sorted by name
+func (m *Metric) LabelPairs() []string {
+	var pairs []string
+	for k, v := range m.Tags {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", SanitizeName(k), EscapeLabelValue(v)))
+	}
+	// Keep the labels order stable between conversions
+	sort.Strings(pairs)
+	return pairs
+}
@@ -0,0 +1,19 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullName(t *testing.T) {
+	m := Metric{Name: "UsageQuantity", Prefix: "aws_ce", Unit: "Hrs"}
+	assert.Equal(t, "aws_ce_usage_quantity_hours", m.FullName())
+	m = Metric{Name: "UnblendedCost", Prefix: "awsBilling", Unit: "USD"}
+	assert.Equal(t, "aws_billing_unblended_cost", m.FullName())
+}
+
+func TestLabelPairs(t *testing.T) {
+	m := Metric{Tags: map[string]string{"tag_aws:createdBy": "a\"b", "account": "payer"}}
+	assert.Equal(t, []string{`account="payer"`, `tag_aws_createdBy="a\"b"`}, m.LabelPairs())
+}
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizeName makes a valid Prometheus metric or label name:
+// invalid characters are replaced with underscores,
+// and names starting with a digit are prefixed with an underscore
+func SanitizeName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// EscapeLabelValue escapes a label value for the Prometheus text exposition format
+func EscapeLabelValue(value string) string {
+	if !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, string(utf8.RuneError))
+	}
+	return labelValueReplacer.Replace(value)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
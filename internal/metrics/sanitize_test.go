@@ -0,0 +1,18 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "tag_aws_createdBy", SanitizeName("tag_aws:createdBy"))
+	assert.Equal(t, "cost_category_cost_center", SanitizeName("cost_category_cost-center"))
+	assert.Equal(t, "_2fa", SanitizeName("2fa"))
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, EscapeLabelValue("a\\b\"c\nd"))
+	assert.Equal(t, "bad�", EscapeLabelValue("bad\xff"))
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"strings"
+)
+
+// knownUnits maps Cost Explorer units to Prometheus unit suffixes
+var knownUnits = map[string]string{
+	"hrs":        "hours",
+	"hours":      "hours",
+	"gb":         "gigabytes",
+	"gb-mo":      "gigabyte_months",
+	"gb-hours":   "gigabyte_hours",
+	"vcpu-hours": "vcpu_hours",
+	"lcu-hrs":    "lcu_hours",
+	"requests":   "requests",
+	"ios":        "ios",
+	"n/a":        "",
+	"count":      "",
+}
+
+// IsCurrency reports whether the unit is an ISO 4217 currency code, e.g. USD
+func IsCurrency(unit string) bool {
+	if len(unit) != 3 {
+		return false
+	}
+	for _, r := range unit {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// UnitSuffix returns the metric name suffix for the unit following the Prometheus conventions.
+// Currencies do not get a suffix, since they are exported as a label
+func UnitSuffix(unit string) string {
+	if unit == "" || IsCurrency(unit) {
+		return ""
+	}
+	if suffix, ok := knownUnits[strings.ToLower(unit)]; ok {
+		return suffix
+	}
+	return strings.Trim(SanitizeName(strings.ToLower(unit)), "_")
+}
+
+// NameWithUnit appends the unit suffix to the metric name unless it is already there
+func NameWithUnit(name, unit string) string {
+	suffix := UnitSuffix(unit)
+	if suffix == "" || strings.HasSuffix(name, "_"+suffix) {
+		return name
+	}
+	return name + "_" + suffix
+}
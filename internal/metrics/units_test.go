@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitSuffix(t *testing.T) {
+	for unit, expected := range map[string]string{
+		"USD":      "",
+		"":         "",
+		"N/A":      "",
+		"Hrs":      "hours",
+		"GB-Mo":    "gigabyte_months",
+		"Requests": "requests",
+		"Queries":  "queries",
+		"Keys-Mo":  "keys_mo",
+	} {
+		assert.Equal(t, expected, UnitSuffix(unit), unit)
+	}
+}
+
+func TestNameWithUnit(t *testing.T) {
+	assert.Equal(t, "usage_quantity_hours", NameWithUnit("usage_quantity", "Hrs"))
+	assert.Equal(t, "unblended_cost", NameWithUnit("unblended_cost", "USD"))
+	assert.Equal(t, "reservation_used_hours", NameWithUnit("reservation_used_hours", "Hrs"))
+}
@@ -0,0 +1,94 @@
+/*
+This package implements the OpenMetrics text format:
+https://prometheus.io/docs/specs/om/open_metrics_spec/
+*/
+package openmetrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+)
+
+const (
+	ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	EOF         = "# EOF\n"
+)
+
+// Family is a set of the samples with the same metric name and metadata
+type Family struct {
+	Name    string
+	Help    string
+	Unit    string
+	Samples []Sample
+}
+
+// Sample of the metric family. Zero timestamp is not written
+type Sample struct {
+	Labels    string
+	Value     float64
+	Timestamp time.Time
+}
+
+// Group groups the metrics into families sorted by name,
+// since the samples of a family have to be contiguous.
+// timestamp returns the timestamp of each sample
+func Group(metrics []intmetrics.Metric, timestamp func(intmetrics.Metric) time.Time) []*Family {
+	index := map[string]*Family{}
+	for _, m := range metrics {
+		name := m.FullName()
+		f, ok := index[name]
+		if !ok {
+			f = &Family{Name: name, Unit: intmetrics.UnitSuffix(m.Unit)}
+			index[name] = f
+		}
+		if f.Help == "" {
+			f.Help = m.Help
+		}
+		f.Samples = append(f.Samples, Sample{
+			Labels:    strings.Join(m.LabelPairs(), ","),
+			Value:     m.Value,
+			Timestamp: timestamp(m),
+		})
+	}
+	families := make([]*Family, 0, len(index))
+	for _, f := range index {
+		sort.SliceStable(f.Samples, func(i, j int) bool {
+			if f.Samples[i].Labels != f.Samples[j].Labels {
+				return f.Samples[i].Labels < f.Samples[j].Labels
+			}
+			return f.Samples[i].Timestamp.Before(f.Samples[j].Timestamp)
+		})
+		families = append(families, f)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// Write writes the families as gauges. The `# EOF` marker is not written,
+// so more metrics can be appended
+func Write(w io.Writer, families []*Family) {
+	for _, f := range families {
+		fmt.Fprintf(w, "# TYPE %s gauge\n", f.Name)
+		if f.Unit != "" {
+			fmt.Fprintf(w, "# UNIT %s %s\n", f.Name, f.Unit)
+		}
+		if f.Help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", f.Name, helpReplacer.Replace(f.Help))
+		}
+		for _, s := range f.Samples {
+			fmt.Fprintf(w, "%s{%s} %s", f.Name, s.Labels, strconv.FormatFloat(s.Value, 'g', -1, 64))
+			if !s.Timestamp.IsZero() {
+				fmt.Fprintf(w, " %s", strconv.FormatFloat(float64(s.Timestamp.UnixMilli())/1000, 'f', -1, 64))
+			}
+			fmt.Fprint(w, "\n")
+		}
+	}
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
@@ -0,0 +1,38 @@
+package openmetrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupAndWrite(t *testing.T) {
+	ts := time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC)
+	metrics := []intmetrics.Metric{
+		{Name: "UsageQuantity", Prefix: "aws_ce", Unit: "Hrs", Value: 24, Tags: map[string]string{"service": "EC2"}},
+		{Name: "UnblendedCost", Prefix: "aws_ce", Unit: "USD", Value: 2, Tags: map[string]string{"service": "S3"}},
+		{Name: "UnblendedCost", Prefix: "aws_ce", Unit: "USD", Value: 1, Help: "Daily \"cost\"",
+			Tags: map[string]string{"service": "EC2"}},
+	}
+	families := Group(metrics, func(m intmetrics.Metric) time.Time {
+		if m.Tags["service"] == "S3" {
+			return ts
+		}
+		return time.Time{}
+	})
+	assert.Len(t, families, 2)
+
+	var buf bytes.Buffer
+	Write(&buf, families)
+	assert.Equal(t, `# TYPE aws_ce_unblended_cost gauge
+# HELP aws_ce_unblended_cost Daily \"cost\"
+aws_ce_unblended_cost{service="EC2"} 1
+aws_ce_unblended_cost{service="S3"} 2 1727827200
+# TYPE aws_ce_usage_quantity_hours gauge
+# UNIT aws_ce_usage_quantity_hours hours
+aws_ce_usage_quantity_hours{service="EC2"} 24
+`, buf.String())
+}
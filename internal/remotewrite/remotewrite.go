@@ -0,0 +1,260 @@
+/*
+This package implements the Prometheus remote write protocol:
+https://prometheus.io/docs/specs/remote_write_spec/
+*/
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// DefaultBatchSize is the number of time series sent in a single request
+	DefaultBatchSize = 500
+	defaultTimeout   = 30 * time.Second
+	metricNameKey    = "__name__"
+)
+
+var (
+	ErrWrite = errors.New("remote write failed")
+	// ErrRecoverable marks the failed writes, which can be retried:
+	// network errors, rate limits and server errors
+	ErrRecoverable = errors.New("recoverable")
+	// ErrDuplicateSample marks the writes rejected, because a sample has a new value
+	// for an existing timestamp. Receivers, e.g. Prometheus, may reject the whole request then
+	ErrDuplicateSample = errors.New("duplicate sample")
+	// ErrOldSample marks the writes rejected, because a sample is older than the receiver accepts,
+	// e.g. a closed cost bucket outside of the out-of-order window. The whole request may be rejected too
+	ErrOldSample = errors.New("old sample")
+
+	// Messages of the duplicate sample errors of Prometheus and Thanos, and of Mimir
+	duplicateSampleMessages = []string{"duplicate sample for timestamp", "sample-duplicate-timestamp"}
+	// Messages of the old sample errors of Prometheus and Thanos, and of Mimir
+	oldSampleMessages = []string{"out of bounds", "too old", "out of order sample", "sample-out-of-order"}
+)
+
+// Label is a label of the time series
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a value of the time series at the Unix timestamp in milliseconds
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries is a set of samples identified by the labels.
+// The metric name is the `__name__` label
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Config of the remote write client
+type Config struct {
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers,omitempty"`
+	Timeout time.Duration     `mapstructure:"timeout,omitempty"`
+	// Either basic auth or the bearer token is used
+	BasicAuth   *BasicAuth `mapstructure:"basic_auth,omitempty"`
+	BearerToken string     `mapstructure:"bearer_token,omitempty"`
+}
+
+// BasicAuth credentials of the remote write endpoint
+type BasicAuth struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// Client sends time series to a remote write endpoint
+type Client struct {
+	url         string
+	headers     map[string]string
+	basicAuth   *BasicAuth
+	bearerToken string
+	http        *http.Client
+}
+
+func NewClient(cfg Config) *Client {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Client{
+		url:         cfg.URL,
+		headers:     cfg.Headers,
+		basicAuth:   cfg.BasicAuth,
+		bearerToken: cfg.BearerToken,
+		http:        &http.Client{Timeout: timeout},
+	}
+}
+
+// Write sends the time series in a single request
+func (c *Client) Write(ctx context.Context, series []TimeSeries) error {
+	return c.Send(ctx, Marshal(series))
+}
+
+// Send sends the marshaled WriteRequest.
+// Errors, which can be retried, wrap ErrRecoverable
+func (c *Client) Send(ctx context.Context, writeRequest []byte) error {
+	body := snappy.Encode(nil, writeRequest)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	switch {
+	case c.basicAuth != nil:
+		req.SetBasicAuth(c.basicAuth.Username, c.basicAuth.Password)
+	case c.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w: %w", ErrWrite, ErrRecoverable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:errcheck
+		err := fmt.Errorf("%w: %s: %s", ErrWrite, resp.Status, bytes.TrimSpace(msg))
+		// The spec allows to retry 5xx and 429 only
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5 {
+			return fmt.Errorf("%w: %w", ErrRecoverable, err)
+		}
+		for _, duplicate := range duplicateSampleMessages {
+			if bytes.Contains(msg, []byte(duplicate)) {
+				return fmt.Errorf("%w: %w", ErrDuplicateSample, err)
+			}
+		}
+		for _, old := range oldSampleMessages {
+			if bytes.Contains(msg, []byte(old)) {
+				return fmt.Errorf("%w: %w", ErrOldSample, err)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// NewTimeSeries returns time series with the name and labels sorted by name
+// as required by the protocol
+func NewTimeSeries(name string, labels map[string]string, samples ...Sample) TimeSeries {
+	ts := TimeSeries{
+		Labels:  []Label{{Name: metricNameKey, Value: name}},
+		Samples: samples,
+	}
+	for k, v := range labels {
+		ts.Labels = append(ts.Labels, Label{Name: k, Value: v})
+	}
+	sort.Slice(ts.Labels, func(i, j int) bool { return ts.Labels[i].Name < ts.Labels[j].Name })
+	sort.Slice(ts.Samples, func(i, j int) bool { return ts.Samples[i].Timestamp < ts.Samples[j].Timestamp })
+	return ts
+}
+
+// FromMetrics groups the metrics with the same name and labels into time series.
+// Samples are timestamped with the metric timestamp or now if it is not set
+func FromMetrics(metrics []intmetrics.Metric) []TimeSeries {
+	index := map[string]int{}
+	series := []TimeSeries{}
+	for _, m := range metrics {
+		m.AddDefaultTags()
+		labels := map[string]string{}
+		for k, v := range m.Tags {
+			labels[intmetrics.SanitizeName(k)] = v
+		}
+		ts := m.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		s := Sample{Value: m.Value, Timestamp: ts.UnixMilli()}
+		name := m.FullName()
+		key := name + "{" + strings.Join(m.LabelPairs(), ",") + "}"
+		if i, ok := index[key]; ok {
+			series[i].Samples = append(series[i].Samples, s)
+			continue
+		}
+		index[key] = len(series)
+		series = append(series, NewTimeSeries(name, labels, s))
+	}
+	for i := range series {
+		samples := series[i].Samples
+		sort.Slice(samples, func(a, b int) bool { return samples[a].Timestamp < samples[b].Timestamp })
+	}
+	return series
+}
+
+// Series splits the marshaled WriteRequest into the marshaled time series.
+// The time series are repeated fields, so any of them joined together are a WriteRequest too
+func Series(writeRequest []byte) ([][]byte, error) {
+	res := [][]byte{}
+	for len(writeRequest) > 0 {
+		num, typ, n := protowire.ConsumeTag(writeRequest)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		if num != 1 || typ != protowire.BytesType {
+			return nil, fmt.Errorf("unexpected field %d of the write request", num)
+		}
+		_, m := protowire.ConsumeBytes(writeRequest[n:])
+		if m < 0 {
+			return nil, protowire.ParseError(m)
+		}
+		res = append(res, writeRequest[:n+m])
+		writeRequest = writeRequest[n+m:]
+	}
+	return res, nil
+}
+
+// Marshal encodes the time series as a protobuf WriteRequest:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func Marshal(series []TimeSeries) []byte {
+	var req []byte
+	for _, ts := range series {
+		var tsBuf []byte
+		for _, l := range ts.Labels {
+			var lBuf []byte
+			lBuf = protowire.AppendTag(lBuf, 1, protowire.BytesType)
+			lBuf = protowire.AppendString(lBuf, l.Name)
+			lBuf = protowire.AppendTag(lBuf, 2, protowire.BytesType)
+			lBuf = protowire.AppendString(lBuf, l.Value)
+			tsBuf = protowire.AppendTag(tsBuf, 1, protowire.BytesType)
+			tsBuf = protowire.AppendBytes(tsBuf, lBuf)
+		}
+		for _, s := range ts.Samples {
+			var sBuf []byte
+			sBuf = protowire.AppendTag(sBuf, 1, protowire.Fixed64Type)
+			sBuf = protowire.AppendFixed64(sBuf, math.Float64bits(s.Value))
+			sBuf = protowire.AppendTag(sBuf, 2, protowire.VarintType)
+			sBuf = protowire.AppendVarint(sBuf, uint64(s.Timestamp)) //nolint:gosec
+			tsBuf = protowire.AppendTag(tsBuf, 2, protowire.BytesType)
+			tsBuf = protowire.AppendBytes(tsBuf, sBuf)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, tsBuf)
+	}
+	return req
+}
@@ -0,0 +1,170 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestNewTimeSeries(t *testing.T) {
+	ts := NewTimeSeries("aws_ce_unblended_cost", map[string]string{"service": "S3", "account": "payer"},
+		Sample{Value: 2, Timestamp: 2000}, Sample{Value: 1, Timestamp: 1000})
+	assert.Equal(t, []Label{
+		{Name: "__name__", Value: "aws_ce_unblended_cost"},
+		{Name: "account", Value: "payer"},
+		{Name: "service", Value: "S3"},
+	}, ts.Labels)
+	assert.Equal(t, int64(1000), ts.Samples[0].Timestamp)
+}
+
+func TestMarshal(t *testing.T) {
+	got := Marshal([]TimeSeries{{
+		Labels:  []Label{{Name: "__name__", Value: "up"}},
+		Samples: []Sample{{Value: 1.5, Timestamp: 1000}},
+	}})
+
+	// WriteRequest.timeseries
+	num, typ, n := protowire.ConsumeTag(got)
+	assert.Equal(t, protowire.Number(1), num)
+	assert.Equal(t, protowire.BytesType, typ)
+	ts, _ := protowire.ConsumeBytes(got[n:])
+
+	// TimeSeries.labels
+	num, _, n = protowire.ConsumeTag(ts)
+	assert.Equal(t, protowire.Number(1), num)
+	label, m := protowire.ConsumeBytes(ts[n:])
+	ts = ts[n+m:]
+	_, _, n = protowire.ConsumeTag(label)
+	name, m := protowire.ConsumeString(label[n:])
+	assert.Equal(t, "__name__", name)
+	_, _, n2 := protowire.ConsumeTag(label[n+m:])
+	value, _ := protowire.ConsumeString(label[n+m+n2:])
+	assert.Equal(t, "up", value)
+
+	// TimeSeries.samples
+	num, _, n = protowire.ConsumeTag(ts)
+	assert.Equal(t, protowire.Number(2), num)
+	sample, _ := protowire.ConsumeBytes(ts[n:])
+	_, _, n = protowire.ConsumeTag(sample)
+	bits, m := protowire.ConsumeFixed64(sample[n:])
+	assert.InDelta(t, 1.5, math.Float64frombits(bits), 0.0001)
+	_, _, n2 = protowire.ConsumeTag(sample[n+m:])
+	tsMs, _ := protowire.ConsumeVarint(sample[n+m+n2:])
+	assert.Equal(t, uint64(1000), tsMs)
+}
+
+func TestClientWrite(t *testing.T) {
+	series := []TimeSeries{NewTimeSeries("up", nil, Sample{Value: 1, Timestamp: 1000})}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		decoded, err := snappy.Decode(nil, body)
+		assert.NoError(t, err)
+		assert.Equal(t, Marshal(series), decoded)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{URL: srv.URL, Headers: map[string]string{"X-Scope-OrgID": "tenant"}})
+	assert.NoError(t, c.Write(context.Background(), series))
+}
+
+func TestClientWriteError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "out of bounds", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := NewClient(Config{URL: srv.URL}).Write(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrWrite)
+	assert.NotErrorIs(t, err, ErrRecoverable)
+	assert.Contains(t, err.Error(), "out of bounds")
+}
+
+func TestClientWriteDuplicateSample(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "duplicate sample for timestamp", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := NewClient(Config{URL: srv.URL}).Write(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrDuplicateSample)
+	assert.NotErrorIs(t, err, ErrRecoverable)
+}
+
+func TestClientWriteOldSample(t *testing.T) {
+	for _, msg := range []string{
+		"out of bounds",
+		"too old sample",
+		"err-mimir-sample-timestamp-too-old: the sample has been rejected because its timestamp is too old",
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, msg, http.StatusBadRequest)
+		}))
+		err := NewClient(Config{URL: srv.URL}).Write(context.Background(), nil)
+		assert.ErrorIs(t, err, ErrOldSample, msg)
+		assert.NotErrorIs(t, err, ErrRecoverable, msg)
+		srv.Close()
+	}
+}
+
+func TestSeries(t *testing.T) {
+	series := []TimeSeries{
+		NewTimeSeries("a", nil, Sample{Value: 1, Timestamp: 1000}),
+		NewTimeSeries("b", map[string]string{"service": "S3"}, Sample{Value: 2, Timestamp: 1000}),
+		NewTimeSeries("c", nil, Sample{Value: 3, Timestamp: 1000}),
+	}
+	got, err := Series(Marshal(series))
+	assert.NoError(t, err)
+	assert.Len(t, got, 3)
+	assert.Equal(t, Marshal(series[1:]), bytes.Join(got[1:], nil))
+
+	got, err = Series(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+	_, err = Series([]byte("garbage"))
+	assert.Error(t, err)
+}
+
+func TestClientAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if ok {
+			assert.Equal(t, "finops", user)
+			assert.Equal(t, "secret", pass)
+		} else {
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	basic := NewClient(Config{URL: srv.URL, BasicAuth: &BasicAuth{Username: "finops", Password: "secret"}})
+	assert.NoError(t, basic.Write(context.Background(), nil))
+	bearer := NewClient(Config{URL: srv.URL, BearerToken: "token"})
+	assert.NoError(t, bearer.Write(context.Background(), nil))
+}
+
+func TestClientWriteRecoverable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	err := NewClient(Config{URL: srv.URL}).Write(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrWrite)
+	assert.ErrorIs(t, err, ErrRecoverable)
+
+	// The endpoint is unreachable
+	srv.Close()
+	err = NewClient(Config{URL: srv.URL}).Write(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrRecoverable)
+}
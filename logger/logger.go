@@ -61,41 +61,41 @@ func init() {
 }
 
 func Info(args ...any) {
-	sugar.Info(args)
+	sugar.Info(args...)
 }
 
 func Infof(message string, args ...any) {
-	sugar.Infof(message, args)
+	sugar.Infof(message, args...)
 }
 
 func Warn(args ...any) {
-	sugar.Warn(args)
+	sugar.Warn(args...)
 }
 
 func Warnf(message string, args ...any) {
-	sugar.Warnf(message, args)
+	sugar.Warnf(message, args...)
 }
 
 func Error(args ...any) {
-	sugar.Error(args)
+	sugar.Error(args...)
 }
 
 func Errorf(message string, args ...any) {
-	sugar.Errorf(message, args)
+	sugar.Errorf(message, args...)
 }
 
 func Fatal(args ...any) {
-	sugar.Fatal(args)
+	sugar.Fatal(args...)
 }
 
 func Fatalf(message string, args ...any) {
-	sugar.Fatalf(message, args)
+	sugar.Fatalf(message, args...)
 }
 
 func Debug(args ...any) {
-	sugar.Debug(args)
+	sugar.Debug(args...)
 }
 
 func Debugf(message string, args ...any) {
-	sugar.Debugf(message, args)
+	sugar.Debugf(message, args...)
 }
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 
 	"github.com/grem11n/cost-exporter/clients"
 	"github.com/grem11n/cost-exporter/config"
@@ -10,16 +14,17 @@ import (
 	"github.com/grem11n/cost-exporter/logger"
 	"github.com/grem11n/cost-exporter/outputs"
 	"github.com/grem11n/cost-exporter/probes"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/mitchellh/mapstructure"
 
 	flag "github.com/spf13/pflag"
 )
 
 // App is a struct that holds parts for the application together
 type App struct {
-	MetricsFormat string
-	Clients       map[string]clients.Client
-	Converter     converters.Converter
-	Outputs       map[string]outputs.Output
+	Clients    map[string]clients.Client
+	Converters map[string]converters.Converter
+	Outputs    map[string]outputs.Output
 }
 
 const (
@@ -28,28 +33,85 @@ const (
 
 var (
 	configPath *string = flag.StringP("config", "c", "./config.yaml", "Path to the configuration file")
-	// Create new global cache as an exchange point
-	cache sync.Map
-	app   = App{
-		MetricsFormat: "prometheus", // only Prometheus is supported for now
-		Clients:       make(map[string]clients.Client),
-		Outputs:       make(map[string]outputs.Output),
+	once       *bool   = flag.Bool("once", false, "Fetch, convert and publish the metrics once and exit, e.g. to run as a CronJob")
+	// Global store as an exchange point
+	st  *store.Store
+	app = App{
+		Clients:    make(map[string]clients.Client),
+		Converters: make(map[string]converters.Converter),
+		Outputs:    make(map[string]outputs.Output),
 	}
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == backfillCommand {
+		runBackfill(os.Args[2:])
+		return
+	}
 	flag.Parse()
 	conf, err := config.New(*configPath)
 	logger.Debug("Config: ", conf)
 	if err != nil {
-		logger.Fatalf("Unable to read the config file: ", err)
+		logger.Fatalf("Unable to read the config file: %s", err)
+	}
+	st = store.New(conf.Store)
+	namespaces := setupClients(conf)
+	subs := setupConverters(conf, namespaces)
+	outputSubs := setupOutputs(conf)
+	if *once {
+		if err := runOnce(subs, outputSubs); err != nil {
+			logger.Fatal(err)
+		}
+		return
 	}
+	validateTTL(conf)
+	go st.Run()
 
 	// Start the probes server
-	probes := probes.New(&conf.Probes, &cache)
+	probes := probes.New(&conf.Probes, st)
 	go probes.Run()
 
-	// Get cloud clients from the registry
+	// Populate the store with raw metrics
+	for _, cl := range app.Clients {
+		go cl.GetMetrics(st)
+	}
+
+	// Convert metrics from the clients' namespaces to the output formats
+	for name, converter := range app.Converters {
+		go converter.Convert(st, subs[name])
+	}
+
+	// Collect the internal metrics
+	go intmetrics.Publish(internalMetricsKey, st)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var wg sync.WaitGroup
+	for name, output := range app.Outputs {
+		// Output the metrics + append the internal metrics
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output.Publish(st, outputSubs[name])
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		logger.Info("Shutting down")
+	case <-done:
+	}
+	closeOutputs()
+}
+
+// setupClients gets the cloud clients from the registry
+// and returns their store namespaces
+func setupClients(conf *config.Config) []string {
+	namespaces := []string{}
 	for clientName, clientConfig := range conf.Clients {
 		constructor := clients.GetClient(clientName)
 		if constructor == nil {
@@ -58,28 +120,56 @@ func main() {
 		logger.Debug("Client config: ", clientConfig)
 		client := constructor(clientConfig)
 		app.Clients[clientName] = client
+		namespaces = append(namespaces, client.Namespace())
 	}
+	return namespaces
+}
 
-	// Populate the cache with raw metrics
-	for _, cl := range app.Clients {
-		go cl.GetMetrics(&cache)
+// validateTTL checks that the store does not drop the metrics
+// of the clients before they are refreshed
+func validateTTL(conf *config.Config) {
+	for name, client := range app.Clients {
+		refresher, ok := client.(clients.Refresher)
+		if !ok {
+			continue
+		}
+		if err := conf.Store.Validate(refresher.RefreshInterval()); err != nil {
+			logger.Fatal("Invalid store config for client ", name, ": ", err)
+		}
 	}
+}
 
-	constructor := converters.GetConverter(app.MetricsFormat)
-	if constructor == nil {
-		logger.Fatalf("Converter %s doesn't exist", app.MetricsFormat)
+// setupConverters gets the converters from the registry
+// and returns their subscriptions by name
+func setupConverters(conf *config.Config, namespaces []string) map[string]converters.Subscription {
+	subs := map[string]converters.Subscription{}
+	for converterName, converterConfig := range conf.Converters {
+		constructor := converters.GetConverter(converterName)
+		if constructor == nil {
+			logger.Fatalf("Converter %s doesn't exist", converterName)
+		}
+		sub, err := converters.DecodeSubscription(converterConfig)
+		if err != nil {
+			logger.Fatal("Invalid converter config: ", err)
+		}
+		if len(sub.Namespaces) == 0 {
+			sub.Namespaces = namespaces
+		}
+		sub.Once = *once
+		app.Converters[converterName] = constructor(converterConfig)
+		subs[converterName] = sub
 	}
-	converter := constructor()
-	app.Converter = converter
-
-	// Convert metrics from the input to the output format
-	// Cache key prefix is hardcoded, because only AWS is supported for now
-	go app.Converter.Convert(&cache, "aws_")
-
-	// Collect the internal metrics
-	go intmetrics.Publish(internalMetricsKey, &cache)
+	return subs
+}
 
-	// Get the outputs from the registry
+// setupOutputs gets the outputs from the registry
+// and returns the store keys to publish by output name
+func setupOutputs(conf *config.Config) map[string][]string {
+	converterNames := []string{}
+	for name := range app.Converters {
+		converterNames = append(converterNames, name)
+	}
+	keys := map[string][]string{}
 	for outputName, outputConfig := range conf.Outputs {
 		constructor := outputs.GetOutput(outputName)
 		logger.Debug("Outputs constructor: ", constructor)
@@ -87,12 +177,34 @@ func main() {
 			logger.Fatalf("Output %s doesn't exist", outputName)
 		}
 		logger.Debug("Output config: ", outputConfig)
-		output := constructor(outputConfig)
-		app.Outputs[outputName] = output
+		var sub outputs.Subscription
+		if err := mapstructure.Decode(outputConfig, &sub); err != nil {
+			logger.Fatal("Invalid output config: ", err)
+		}
+		if len(sub.Converters) == 0 {
+			sub.Converters = converterNames
+		}
+		for _, name := range sub.Converters {
+			if _, ok := app.Converters[name]; !ok {
+				logger.Fatal("Output ", outputName, " subscribes to the unknown converter ", name)
+			}
+		}
+		app.Outputs[outputName] = constructor(outputConfig)
+		// Publish the converted metrics + the internal metrics
+		keys[outputName] = append(sub.Converters, internalMetricsKey)
 	}
+	return keys
+}
 
-	// Output the metrics + append the internal metrics
-	for _, out := range app.Outputs {
-		out.Publish(&cache, []string{app.MetricsFormat, internalMetricsKey})
+// closeOutputs lets the outputs clean up on shutdown
+func closeOutputs() {
+	for name, output := range app.Outputs {
+		closer, ok := output.(outputs.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			logger.Error("Cannot close output ", name, ": ", err)
+		}
 	}
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grem11n/cost-exporter/clients"
+	"github.com/grem11n/cost-exporter/converters"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/outputs"
+)
+
+var (
+	ErrOnce = errors.New("one-shot run failed")
+)
+
+// runOnce fetches the metrics of all the clients, converts them
+// and publishes them with the outputs. All the outputs have to support the one-shot mode,
+// otherwise the metrics would not be published anywhere.
+// Failed queries do not stop the run, but it fails in the end,
+// so the scheduler, e.g. a Kubernetes CronJob, reports it
+func runOnce(subs map[string]converters.Subscription, keys map[string][]string) error {
+	onceOutputs := map[string]outputs.OncePublisher{}
+	for name, output := range app.Outputs {
+		onceOutput, ok := output.(outputs.OncePublisher)
+		if !ok {
+			return fmt.Errorf("%w: output %s doesn't support the one-shot mode", ErrOnce, name)
+		}
+		onceOutputs[name] = onceOutput
+	}
+
+	var errs []error
+	for name, client := range app.Clients {
+		onceClient, ok := client.(clients.OnceClient)
+		if !ok {
+			logger.Warn("Client ", name, " doesn't support the one-shot mode")
+			continue
+		}
+		if err := onceClient.GetMetricsOnce(st); err != nil {
+			errs = append(errs, fmt.Errorf("client %s: %w", name, err))
+		}
+	}
+
+	for name, converter := range app.Converters {
+		// Returns after a single conversion, since the subscription is one-shot
+		converter.Convert(st, subs[name])
+	}
+	intmetrics.PublishOnce(internalMetricsKey, st)
+
+	for name, onceOutput := range onceOutputs {
+		if err := onceOutput.PublishOnce(st, keys[name]); err != nil {
+			errs = append(errs, fmt.Errorf("output %s: %w", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrOnce, errors.Join(errs...))
+	}
+	logger.Info("Published the metrics once")
+	return nil
+}
@@ -0,0 +1,152 @@
+package outputs
+
+// This file implements the REST API of the HTTP output:
+// GET /api/v1/costs returns the metrics converted by the `json` converter.
+// Filters:
+//   - query=<name> returns the metrics of the query. Can be repeated
+//   - metric=<name> returns the metrics by name, e.g. aws_ce_unblended_cost. Can be repeated
+//   - match=<label><op><value> returns the metrics with the matching labels,
+//     op is one of =, !=, =~, !~ like in Prometheus. All the matchers have to match
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sync/atomic"
+
+	"github.com/grem11n/cost-exporter/converters"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
+)
+
+const (
+	apiCostsPath = "/api/v1/costs"
+)
+
+var (
+	ErrMatcher = errors.New("invalid label matcher")
+
+	matcherRe = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)(=~|!~|!=|=)(.*)$`)
+)
+
+type apiResponse struct {
+	Status string                `json:"status"`
+	Data   []converters.Document `json:"data"`
+	Error  string                `json:"error,omitempty"`
+}
+
+// costsCache keeps the documents decoded from the latest JSON payload,
+// so the requests do not decode the payload every time
+type costsCache struct {
+	docs atomic.Pointer[[]converters.Document]
+}
+
+// run decodes the JSON payload on every conversion
+func (c *costsCache) run(st *store.Store) {
+	watchPayload(st, converters.JSONName, c.update)
+}
+
+func (c *costsCache) update(payload []byte) {
+	var docs []converters.Document
+	if err := json.Unmarshal(payload, &docs); err != nil {
+		logger.Error("Cannot decode JSON metrics: ", err)
+		return
+	}
+	c.docs.Store(&docs)
+}
+
+// matcher matches a label value, e.g. `service=~Amazon.*`.
+// Missing labels have empty values
+type matcher struct {
+	label string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (h *HTTP) handleCosts(cache *costsCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		docs := cache.docs.Load()
+		if docs == nil {
+			writeAPIResponse(w, http.StatusServiceUnavailable, apiResponse{Status: "error", Error: "cost data is not available yet"})
+			return
+		}
+
+		params := r.URL.Query()
+		matchers := []matcher{}
+		for _, m := range params["match"] {
+			parsed, err := parseMatcher(m)
+			if err != nil {
+				writeAPIResponse(w, http.StatusBadRequest, apiResponse{Status: "error", Error: err.Error()})
+				return
+			}
+			matchers = append(matchers, parsed)
+		}
+
+		res := []converters.Document{}
+		for _, doc := range *docs {
+			if len(params["query"]) > 0 && !slices.Contains(params["query"], doc.Query) {
+				continue
+			}
+			if len(params["metric"]) > 0 && !slices.Contains(params["metric"], doc.Metric) {
+				continue
+			}
+			if !matchAll(matchers, doc.Labels) {
+				continue
+			}
+			res = append(res, doc)
+		}
+		writeAPIResponse(w, http.StatusOK, apiResponse{Status: "success", Data: res})
+	}
+}
+
+func writeAPIResponse(w http.ResponseWriter, code int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error(err)
+	}
+}
+
+func parseMatcher(s string) (matcher, error) {
+	parts := matcherRe.FindStringSubmatch(s)
+	if parts == nil {
+		return matcher{}, fmt.Errorf("%w: %s", ErrMatcher, s)
+	}
+	m := matcher{label: parts[1], op: parts[2], value: parts[3]}
+	if m.op == "=~" || m.op == "!~" {
+		// Regular expressions are fully anchored like in Prometheus
+		re, err := regexp.Compile("^(?:" + m.value + ")$")
+		if err != nil {
+			return matcher{}, fmt.Errorf("%w: %s: %w", ErrMatcher, s, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+func (m matcher) matches(labels map[string]string) bool {
+	value := labels[m.label]
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+func matchAll(matchers []matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package outputs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grem11n/cost-exporter/converters"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDocs = []converters.Document{
+	{Metric: "aws_ce_unblended_cost", Query: "daily", Labels: map[string]string{"service": "Amazon S3"}, Value: 1},
+	{Metric: "aws_ce_unblended_cost", Query: "daily", Labels: map[string]string{"service": "AWS Lambda"}, Value: 2},
+	{Metric: "aws_ce_usage_quantity_hours", Query: "ec2_usage", Labels: map[string]string{"service": "Amazon EC2"}, Value: 24},
+}
+
+func getCosts(t *testing.T, cache *costsCache, query string) (int, apiResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	(&HTTP{}).handleCosts(cache)(rec, httptest.NewRequest(http.MethodGet, apiCostsPath+query, nil))
+	var resp apiResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec.Code, resp
+}
+
+func TestHandleCosts(t *testing.T) {
+	cache := &costsCache{}
+	code, resp := getCosts(t, cache, "")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "error", resp.Status)
+
+	payload, err := json.Marshal(testDocs)
+	assert.NoError(t, err)
+	cache.update(payload)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"all", "", 3},
+		{"query", "?query=daily", 2},
+		{"several queries", "?query=daily&query=ec2_usage", 3},
+		{"metric", "?metric=aws_ce_usage_quantity_hours", 1},
+		{"equal", "?match=service%3DAmazon+S3", 1},
+		{"not equal", "?match=service!%3DAmazon+S3", 2},
+		{"regex", "?match=service%3D~Amazon.*", 2},
+		{"not regex", "?match=service!~Amazon.*", 1},
+		{"all matchers", "?match=service%3D~Amazon.*&match=service!%3DAmazon+EC2", 1},
+		{"missing label", "?match=team%3D", 3},
+		{"nothing", "?query=monthly", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := getCosts(t, cache, tt.query)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, "success", resp.Status)
+			assert.Len(t, resp.Data, tt.want)
+		})
+	}
+
+	code, resp = getCosts(t, cache, "?match=service")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, resp.Error, ErrMatcher.Error())
+}
+
+func TestCostsCacheKeepsValidDocs(t *testing.T) {
+	payload, err := json.Marshal(testDocs)
+	assert.NoError(t, err)
+	cache := &costsCache{}
+	cache.update(payload)
+
+	// Invalid payloads do not replace the decoded documents
+	cache.update([]byte("not json"))
+	assert.Len(t, *cache.docs.Load(), 3)
+}
+
+func TestParseMatcher(t *testing.T) {
+	_, err := parseMatcher("service=~(")
+	assert.ErrorIs(t, err, ErrMatcher)
+	_, err = parseMatcher("1service=S3")
+	assert.ErrorIs(t, err, ErrMatcher)
+	m, err := parseMatcher("service!=S3")
+	assert.NoError(t, err)
+	assert.Equal(t, matcher{label: "service", op: "!=", value: "S3"}, m)
+}
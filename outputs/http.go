@@ -8,36 +8,59 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
-	"sync"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/grem11n/cost-exporter/converters"
+	"github.com/grem11n/cost-exporter/internal/openmetrics"
 	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
 )
 
 // HTTP config for the HTTP output
 type HTTP struct {
-	Path string
-	Port int
+	Path string `mapstructure:"path,omitempty"`
+	Port int    `mapstructure:"port,omitempty"`
 }
 
 const (
-	defaultPath = "/metrics"
-	defaultPort = 8080
+	defaultPath          = "/metrics"
+	defaultPort          = 8080
+	openMetricsMediaType = "application/openmetrics-text"
+	textContentType      = "text/plain; version=0.0.4; charset=utf-8"
 )
 
 func init() {
 	logger.Info("Initializing HTTP output")
-	Register("http", func(OutputConfig) Output { return &HTTP{} })
+	Register("http", func(conf OutputConfig) Output {
+		h, err := newHTTP(conf)
+		if err != nil {
+			logger.Fatal("Unable to decode HTTP config: ", err)
+		}
+		return h
+	})
+}
+
+// newHTTP decodes the path and the port from the output config
+func newHTTP(conf OutputConfig) (*HTTP, error) {
+	var h HTTP
+	if err := decodeOutputConfig(conf, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
 }
 
 // Publish metrics on an HTTP endpoint.
-// cache is a pointer to the exchange point cache
-// keys - keys within the cache to get metrics from
-func (h *HTTP) Publish(cache *sync.Map, keys []string) {
+// st is a pointer to the exchange point store
+// keys - keys within the store to get the converted metrics from
+func (h *HTTP) Publish(st *store.Store, keys []string) {
 	path := h.Path
 	if path == "" {
-		logger.Infof("Using the default metrics path: ", defaultPath)
+		logger.Infof("Using the default metrics path: %s", defaultPath)
 		path = defaultPath
 	}
 	port := h.Port
@@ -46,7 +69,12 @@ func (h *HTTP) Publish(cache *sync.Map, keys []string) {
 		port = defaultPort
 	}
 	http.HandleFunc("/", h.handleRoot(path))
-	http.HandleFunc(path, h.handleMetrics(keys, cache))
+	http.HandleFunc(path, h.handleMetrics(keys, st))
+	if slices.Contains(keys, converters.JSONName) {
+		cache := &costsCache{}
+		go cache.run(st)
+		http.HandleFunc(apiCostsPath, h.handleCosts(cache))
+	}
 
 	server := &http.Server{
 		Addr:              fmt.Sprintf(":%d", port),
@@ -69,34 +97,34 @@ func (h *HTTP) handleRoot(metricsPath string) http.HandlerFunc {
 	}
 }
 
-func (h *HTTP) handleMetrics(keys []string, cache *sync.Map) http.HandlerFunc {
-	return func(w http.ResponseWriter, _ *http.Request) {
+func (h *HTTP) handleMetrics(subscribed []string, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		logger.Info("Got request for metrics")
+		keys, openMetrics := negotiate(r.Header.Get("Accept"), subscribed)
 		var res bytes.Buffer
 		for _, key := range keys {
-			r, ok := cache.Load(key)
+			rb, ok := st.Payload(key)
 			if !ok {
-				logger.Error("Cannot get metrics from cache")
+				logger.Error("Cannot get metrics from the store")
 				w.WriteHeader(http.StatusInternalServerError)
-				_, err := w.Write([]byte("500 - Cannot get metrics from cache"))
+				_, err := w.Write([]byte("500 - Cannot get metrics from the store"))
 				if err != nil {
 					logger.Error(err)
 				}
 				return
 			}
-			rb, ok := r.([]byte)
-			if !ok {
-				logger.Error("Odd metrics format")
-				w.WriteHeader(http.StatusInternalServerError)
-				_, err := w.Write([]byte("500 - Odd metrics format"))
-				if err != nil {
-					logger.Error(err)
-				}
-				return
+			// OpenMetrics allows no arbitrary comments
+			if !openMetrics {
+				fmt.Fprintf(&res, "# Metrics from %s\r\n", key)
 			}
-			fmt.Fprintf(&res, "# Metrics from %s\r\n", key)
 			res.Write(rb)
 		}
+		if openMetrics {
+			res.WriteString(openmetrics.EOF)
+			w.Header().Set("Content-Type", openmetrics.ContentType)
+		} else {
+			w.Header().Set("Content-Type", textContentType)
+		}
 
 		logger.Debug(res.String())
 		if _, err := io.WriteString(w, res.String()); err != nil {
@@ -109,3 +137,72 @@ func (h *HTTP) handleMetrics(keys []string, cache *sync.Map) http.HandlerFunc {
 		}
 	}
 }
+
+// negotiate returns the keys to serve depending on the Accept header.
+// OpenMetrics is served if the scraper prefers it and the openmetrics converter is subscribed.
+// The classic text format is served otherwise: from the prometheus converter
+// or from the openmetrics one, if only it is subscribed.
+// Other keys, e.g. the internal metrics, are served in both formats
+func negotiate(accept string, keys []string) ([]string, bool) {
+	openMetrics := prefersOpenMetrics(accept) && slices.Contains(keys, converters.OpenMetricsName)
+	textFallback := !slices.Contains(keys, converters.PrometheusName)
+	res := []string{}
+	for _, key := range keys {
+		switch key {
+		case converters.OpenMetricsName:
+			switch {
+			case openMetrics:
+				res = append(res, key)
+			case textFallback:
+				res = append(res, converters.OpenMetricsTextName)
+			}
+		case converters.PrometheusName:
+			if !openMetrics {
+				res = append(res, key)
+			}
+		case converters.JSONName, converters.InfluxName, converters.RemoteWriteName:
+			// These formats are served by the API or pushed by the other outputs
+			continue
+		default:
+			res = append(res, key)
+		}
+	}
+	return res, openMetrics
+}
+
+// prefersOpenMetrics checks whether the Accept header explicitly asks for OpenMetrics
+// with a quality not lower than the one of the classic text format.
+// The most specific media range matching text/plain defines its quality
+func prefersOpenMetrics(accept string) bool {
+	var (
+		openMetricsQ, textQ float64
+		textSpecificity     = -1
+	)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case openMetricsMediaType:
+			openMetricsQ = max(openMetricsQ, q)
+		case "text/plain":
+			textQ, textSpecificity = q, 2
+		case "text/*":
+			if textSpecificity < 1 {
+				textQ, textSpecificity = q, 1
+			}
+		case "*/*":
+			if textSpecificity < 0 {
+				textQ, textSpecificity = q, 0
+			}
+		}
+	}
+	return openMetricsQ > 0 && openMetricsQ >= textQ
+}
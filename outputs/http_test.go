@@ -0,0 +1,98 @@
+package outputs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grem11n/cost-exporter/converters"
+	"github.com/grem11n/cost-exporter/internal/openmetrics"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+const internalKey = "prometheus-internal"
+
+func testStore() *store.Store {
+	st := store.New(store.Config{})
+	st.PutPayload(converters.PrometheusName, []byte("aws_ce_cost 1\n"))
+	st.PutPayload(converters.OpenMetricsName, []byte("# TYPE aws_ce_cost gauge\naws_ce_cost 1 1727827200\n"))
+	st.PutPayload(internalKey, []byte("cost_exporter_aws_calls_total 3\n"))
+	return st
+}
+
+func TestNewHTTP(t *testing.T) {
+	h, err := newHTTP(map[string]any{
+		"converters": []string{"prometheus"},
+		"path":       "/costs",
+		"port":       9100,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &HTTP{Path: "/costs", Port: 9100}, h)
+
+	_, err = newHTTP(map[string]any{"port": "not a port"})
+	assert.Error(t, err)
+}
+
+func TestNegotiate(t *testing.T) {
+	keys := []string{converters.PrometheusName, converters.OpenMetricsName, internalKey}
+	got, om := negotiate("application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5", keys)
+	assert.True(t, om)
+	assert.Equal(t, []string{converters.OpenMetricsName, internalKey}, got)
+
+	got, om = negotiate("text/plain", append(keys, converters.JSONName, converters.InfluxName, converters.RemoteWriteName))
+	assert.False(t, om)
+	assert.Equal(t, []string{converters.PrometheusName, internalKey}, got)
+
+	// OpenMetrics is not served if the converter is not subscribed
+	got, om = negotiate(openMetricsMediaType, []string{converters.PrometheusName, internalKey})
+	assert.False(t, om)
+	assert.Equal(t, []string{converters.PrometheusName, internalKey}, got)
+
+	// The classic text format is rendered by the openmetrics converter without the prometheus one
+	got, om = negotiate("text/plain", []string{converters.OpenMetricsName, internalKey})
+	assert.False(t, om)
+	assert.Equal(t, []string{converters.OpenMetricsTextName, internalKey}, got)
+}
+
+func TestPrefersOpenMetrics(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                             false,
+		"*/*":                          false,
+		"text/plain":                   false,
+		"application/openmetrics-text": true,
+		"application/openmetrics-text; version=1.0.0, text/plain":                                   true,
+		"application/openmetrics-text;version=1.0.0;q=0.6,text/plain;version=0.0.4;q=0.3,*/*;q=0.2": true,
+		"application/openmetrics-text;q=0":                                                          false,
+		"text/plain;q=0.9, application/openmetrics-text;q=0.5":                                      false,
+		"application/openmetrics-text;q=0.5, text/*;q=0.3, */*":                                     true,
+		"application/openmetrics-text-foo":                                                          false,
+	} {
+		assert.Equal(t, want, prefersOpenMetrics(accept), accept)
+	}
+}
+
+func TestHandleMetricsOpenMetrics(t *testing.T) {
+	h := &HTTP{}
+	handler := h.handleMetrics([]string{converters.PrometheusName, converters.OpenMetricsName, internalKey}, testStore())
+
+	req := httptest.NewRequest(http.MethodGet, defaultPath, nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, openmetrics.ContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE aws_ce_cost gauge\naws_ce_cost 1 1727827200\ncost_exporter_aws_calls_total 3\n# EOF\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, defaultPath, nil))
+	assert.Equal(t, textContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "# Metrics from prometheus\r\naws_ce_cost 1\n")
+	assert.NotContains(t, rec.Body.String(), "# EOF")
+}
+
+func TestHandleMetricsMissingPayload(t *testing.T) {
+	h := &HTTP{}
+	rec := httptest.NewRecorder()
+	h.handleMetrics([]string{"missing"}, testStore())(rec, httptest.NewRequest(http.MethodGet, defaultPath, nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,246 @@
+// This file implements the InfluxDB output:
+// It writes the line protocol from the influx converter to the InfluxDB v2 API
+package outputs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/grem11n/cost-exporter/converters"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
+)
+
+// InfluxDBConfig of the InfluxDB output
+type InfluxDBConfig struct {
+	// Base URL of InfluxDB, e.g. http://localhost:8086
+	URL    string `mapstructure:"url"`
+	Org    string `mapstructure:"org"`
+	Bucket string `mapstructure:"bucket"`
+	// API token with the write permission to the bucket
+	Token string `mapstructure:"token,omitempty"`
+	// Max number of points per request
+	BatchSize int  `mapstructure:"batch_size,omitempty"`
+	Gzip      bool `mapstructure:"gzip,omitempty"`
+	// Number of retries of a failed batch. Client errors are not retried
+	MaxRetries *int          `mapstructure:"max_retries,omitempty"`
+	RetryDelay time.Duration `mapstructure:"retry_delay,omitempty"`
+	Timeout    time.Duration `mapstructure:"timeout,omitempty"`
+}
+
+// InfluxDB output
+type InfluxDB struct {
+	cfg  InfluxDBConfig
+	http *http.Client
+}
+
+const (
+	influxDBWritePath          = "/api/v2/write"
+	defaultInfluxDBBatchSize   = 5000
+	defaultInfluxDBMaxRetries  = 3
+	defaultInfluxDBRetryDelay  = 1 * time.Second
+	defaultInfluxDBTimeout     = 30 * time.Second
+	influxDBWrittenPointsName  = "cost_exporter_output_points_total{job=\"cost-exporter\",output=\"influxdb\"}"
+	influxDBFailedBatchesName  = "cost_exporter_output_failed_batches_total{job=\"cost-exporter\",output=\"influxdb\"}"
+	influxDBMaxErrorBodyLength = 512
+)
+
+var (
+	ErrInfluxDBWrite  = errors.New("InfluxDB write failed")
+	ErrInfluxDBConfig = errors.New("invalid InfluxDB config")
+
+	influxDBWrittenPoints *metrics.Counter
+	influxDBFailedBatches *metrics.Counter
+)
+
+func init() {
+	logger.Info("Initializing InfluxDB output")
+	Register("influxdb", func(conf OutputConfig) Output {
+		var cfg InfluxDBConfig
+		if err := decodeOutputConfig(conf, &cfg); err != nil {
+			logger.Fatal("Unable to decode InfluxDB config: ", err)
+		}
+		i, err := NewInfluxDB(cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		return i
+	})
+	influxDBWrittenPoints = intmetrics.InternalMetricsSet.GetOrCreateCounter(influxDBWrittenPointsName)
+	influxDBFailedBatches = intmetrics.InternalMetricsSet.GetOrCreateCounter(influxDBFailedBatchesName)
+}
+
+// NewInfluxDB returns the InfluxDB output with the defaults set.
+// The URL, the org and the bucket are required
+func NewInfluxDB(cfg InfluxDBConfig) (*InfluxDB, error) {
+	if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http(s) URL: %q", ErrInfluxDBConfig, cfg.URL)
+	}
+	if cfg.Org == "" {
+		return nil, fmt.Errorf("%w: org is required", ErrInfluxDBConfig)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("%w: bucket is required", ErrInfluxDBConfig)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultInfluxDBBatchSize
+	}
+	if cfg.MaxRetries == nil {
+		retries := defaultInfluxDBMaxRetries
+		cfg.MaxRetries = &retries
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultInfluxDBRetryDelay
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultInfluxDBTimeout
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return &InfluxDB{cfg: cfg, http: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// Publish writes the line protocol to InfluxDB every time it is converted.
+// Only the influx converter payload is written, other keys are not in the line protocol
+func (i *InfluxDB) Publish(st *store.Store, keys []string) {
+	if !slices.Contains(keys, converters.InfluxName) {
+		logger.Error("InfluxDB output requires the converter: ", converters.InfluxName)
+		return
+	}
+	logger.Info("Writing metrics to InfluxDB: ", i.cfg.URL)
+	watchPayload(st, converters.InfluxName, func(payload []byte) {
+		if err := i.push(context.Background(), payload); err != nil {
+			logger.Error("Cannot write metrics to InfluxDB: ", err)
+		}
+	})
+}
+
+// PublishOnce writes the current line protocol a single time
+func (i *InfluxDB) PublishOnce(st *store.Store, keys []string) error {
+	if !slices.Contains(keys, converters.InfluxName) {
+		return fmt.Errorf("%w: the %s converter is required", ErrInfluxDBWrite, converters.InfluxName)
+	}
+	payload, ok := st.Payload(converters.InfluxName)
+	if !ok {
+		return fmt.Errorf("%w: no metrics to write", ErrInfluxDBWrite)
+	}
+	return i.push(context.Background(), payload)
+}
+
+// push writes the payload in batches. Failed batches are skipped,
+// since the whole payload is written again on the next conversion
+func (i *InfluxDB) push(ctx context.Context, payload []byte) error {
+	var errs []error
+	for _, batch := range batchLines(payload, i.cfg.BatchSize) {
+		if err := i.writeWithRetries(ctx, batch); err != nil {
+			influxDBFailedBatches.Inc()
+			errs = append(errs, err)
+			continue
+		}
+		influxDBWrittenPoints.Add(bytes.Count(batch, []byte("\n")))
+	}
+	return errors.Join(errs...)
+}
+
+// writeWithRetries retries the failed write with the exponential backoff
+func (i *InfluxDB) writeWithRetries(ctx context.Context, batch []byte) error {
+	delay := i.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := i.write(ctx, batch)
+		if err == nil || !retry || attempt >= *i.cfg.MaxRetries {
+			return err
+		}
+		logger.Warnf("InfluxDB write failed, retrying in %s: %s", delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// write sends a single batch. It reports whether the failed write can be retried:
+// network errors, rate limits and server errors are temporary
+func (i *InfluxDB) write(ctx context.Context, batch []byte) (bool, error) {
+	body, err := i.encode(batch)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.writeURL(), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if i.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.cfg.Token)
+	}
+	resp, err := i.http.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, influxDBMaxErrorBodyLength)) //nolint:errcheck
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+	return retry, fmt.Errorf("%w: %s: %s", ErrInfluxDBWrite, resp.Status, bytes.TrimSpace(msg))
+}
+
+func (i *InfluxDB) encode(batch []byte) ([]byte, error) {
+	if !i.cfg.Gzip {
+		return batch, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(batch); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (i *InfluxDB) writeURL() string {
+	query := url.Values{}
+	query.Set("org", i.cfg.Org)
+	query.Set("bucket", i.cfg.Bucket)
+	// The influx converter writes the timestamps in seconds
+	query.Set("precision", "s")
+	return i.cfg.URL + influxDBWritePath + "?" + query.Encode()
+}
+
+// batchLines splits the newline terminated lines into batches of at most size lines
+func batchLines(payload []byte, size int) [][]byte {
+	batches := [][]byte{}
+	start, count := 0, 0
+	for pos, b := range payload {
+		if b != '\n' {
+			continue
+		}
+		count++
+		if count == size {
+			batches = append(batches, payload[start:pos+1])
+			start, count = pos+1, 0
+		}
+	}
+	if start < len(payload) {
+		batches = append(batches, payload[start:])
+	}
+	return batches
+}
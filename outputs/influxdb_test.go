@@ -0,0 +1,125 @@
+package outputs
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grem11n/cost-exporter/converters"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchLines(t *testing.T) {
+	payload := []byte("a value=1\nb value=2\nc value=3\n")
+	assert.Equal(t, [][]byte{[]byte("a value=1\nb value=2\n"), []byte("c value=3\n")}, batchLines(payload, 2))
+	assert.Equal(t, [][]byte{payload}, batchLines(payload, 5))
+	assert.Empty(t, batchLines(nil, 2))
+}
+
+func TestNewInfluxDB(t *testing.T) {
+	for _, cfg := range []InfluxDBConfig{
+		{Org: "finops", Bucket: "costs"},
+		{URL: "localhost:8086", Org: "finops", Bucket: "costs"},
+		{URL: "http://localhost:8086", Bucket: "costs"},
+		{URL: "http://localhost:8086", Org: "finops"},
+	} {
+		_, err := NewInfluxDB(cfg)
+		assert.ErrorIs(t, err, ErrInfluxDBConfig)
+	}
+	i, err := NewInfluxDB(InfluxDBConfig{URL: "http://localhost:8086/", Org: "finops", Bucket: "costs"})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8086", i.cfg.URL)
+	assert.Equal(t, defaultInfluxDBBatchSize, i.cfg.BatchSize)
+}
+
+func TestInfluxDBPush(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		body, err := io.ReadAll(zr)
+		assert.NoError(t, err)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	i, err := NewInfluxDB(InfluxDBConfig{URL: server.URL + "/", Org: "finops", Bucket: "costs", Token: "secret", BatchSize: 2, Gzip: true})
+	assert.NoError(t, err)
+	assert.NoError(t, i.push(context.Background(), []byte("a value=1 1727740800\nb value=2 1727740800\nc value=3 1727740800\n")))
+
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "/api/v2/write", requests[0].URL.Path)
+	assert.Equal(t, "bucket=costs&org=finops&precision=s", requests[0].URL.RawQuery)
+	assert.Equal(t, "Token secret", requests[0].Header.Get("Authorization"))
+	assert.Equal(t, "gzip", requests[0].Header.Get("Content-Encoding"))
+	assert.Equal(t, []string{"a value=1 1727740800\nb value=2 1727740800\n", "c value=3 1727740800\n"}, bodies)
+}
+
+func TestInfluxDBRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	i, err := NewInfluxDB(InfluxDBConfig{URL: server.URL, Org: "finops", Bucket: "costs", RetryDelay: time.Millisecond})
+	assert.NoError(t, err)
+	assert.NoError(t, i.writeWithRetries(context.Background(), []byte("a value=1\n")))
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestInfluxDBNoRetryOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code":"invalid","message":"unable to parse"}`))
+	}))
+	defer server.Close()
+
+	i, err := NewInfluxDB(InfluxDBConfig{URL: server.URL, Org: "finops", Bucket: "costs", RetryDelay: time.Millisecond})
+	assert.NoError(t, err)
+	err = i.writeWithRetries(context.Background(), []byte("a value=1\n"))
+	assert.ErrorIs(t, err, ErrInfluxDBWrite)
+	assert.Contains(t, err.Error(), "unable to parse")
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestInfluxDBPublishOnce(t *testing.T) {
+	var bodies []string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	i, err := NewInfluxDB(InfluxDBConfig{URL: server.URL, Org: "finops", Bucket: "costs"})
+	assert.NoError(t, err)
+	st := store.New(store.Config{})
+	assert.ErrorIs(t, i.PublishOnce(st, []string{converters.InfluxName}), ErrInfluxDBWrite)
+	assert.ErrorIs(t, i.PublishOnce(st, []string{converters.JSONName}), ErrInfluxDBWrite)
+
+	st.PutPayload(converters.InfluxName, []byte("a value=1 1727740800\n"))
+	assert.NoError(t, i.PublishOnce(st, []string{converters.InfluxName}))
+	assert.Equal(t, []string{"a value=1 1727740800\n"}, bodies)
+
+	// Rejected batches fail the run
+	status = http.StatusBadRequest
+	assert.ErrorIs(t, i.PublishOnce(st, []string{converters.InfluxName}), ErrInfluxDBWrite)
+}
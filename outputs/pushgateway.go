@@ -0,0 +1,199 @@
+// This file implements the Pushgateway output:
+// It pushes the metrics in the Prometheus text format to a Pushgateway
+// under the job and the grouping key, e.g. for the one-shot runs as a CronJob
+package outputs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grem11n/cost-exporter/converters"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
+)
+
+// PushgatewayConfig of the Pushgateway output
+type PushgatewayConfig struct {
+	// Base URL of the Pushgateway, e.g. http://pushgateway:9091
+	URL string `mapstructure:"url"`
+	Job string `mapstructure:"job,omitempty"`
+	// Labels of the group in addition to the job
+	Grouping map[string]string `mapstructure:"grouping,omitempty"`
+	// PUT replaces all the metrics in the group, POST replaces the metrics with the same names only
+	Method           string            `mapstructure:"method,omitempty"`
+	DeleteOnShutdown bool              `mapstructure:"delete_on_shutdown,omitempty"`
+	Headers          map[string]string `mapstructure:"headers,omitempty"`
+	Timeout          time.Duration     `mapstructure:"timeout,omitempty"`
+}
+
+// Pushgateway output
+type Pushgateway struct {
+	cfg  PushgatewayConfig
+	http *http.Client
+}
+
+const (
+	defaultPushgatewayJob     = "cost-exporter"
+	defaultPushgatewayTimeout = 30 * time.Second
+)
+
+var (
+	ErrPush = errors.New("push to Pushgateway failed")
+)
+
+func init() {
+	logger.Info("Initializing Pushgateway output")
+	Register("pushgateway", func(conf OutputConfig) Output {
+		var cfg PushgatewayConfig
+		if err := decodeOutputConfig(conf, &cfg); err != nil {
+			logger.Fatal("Unable to decode Pushgateway config: ", err)
+		}
+		p, err := NewPushgateway(cfg)
+		if err != nil {
+			logger.Fatal("Invalid Pushgateway config: ", err)
+		}
+		return p
+	})
+}
+
+// NewPushgateway returns the Pushgateway output with the defaults set
+func NewPushgateway(cfg PushgatewayConfig) (*Pushgateway, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("%w: url is required", ErrPush)
+	}
+	if cfg.Job == "" {
+		cfg.Job = defaultPushgatewayJob
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	switch cfg.Method {
+	case "":
+		cfg.Method = http.MethodPut
+	case http.MethodPut, http.MethodPost:
+	default:
+		return nil, fmt.Errorf("%w: unsupported method %s", ErrPush, cfg.Method)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultPushgatewayTimeout
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return &Pushgateway{cfg: cfg, http: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// Publish pushes the metrics every time the prometheus converter updates them.
+// The internal metrics are pushed along
+func (p *Pushgateway) Publish(st *store.Store, keys []string) {
+	if !slices.Contains(keys, converters.PrometheusName) {
+		logger.Error("Pushgateway output requires the converter: ", converters.PrometheusName)
+		return
+	}
+	logger.Info("Pushing metrics to Pushgateway: ", p.groupURL())
+	watchPayload(st, converters.PrometheusName, func([]byte) { p.pushAndLog(st, keys) })
+}
+
+// PublishOnce pushes the current metrics a single time
+func (p *Pushgateway) PublishOnce(st *store.Store, keys []string) error {
+	if !slices.Contains(keys, converters.PrometheusName) {
+		return fmt.Errorf("%w: the %s converter is required", ErrPush, converters.PrometheusName)
+	}
+	if _, ok := st.Payload(converters.PrometheusName); !ok {
+		return fmt.Errorf("%w: no metrics to push", ErrPush)
+	}
+	return p.push(context.Background(), st, keys)
+}
+
+// Close deletes the group from the Pushgateway if delete_on_shutdown is set,
+// so the metrics of the stopped exporter are not scraped forever
+func (p *Pushgateway) Close() error {
+	if !p.cfg.DeleteOnShutdown {
+		return nil
+	}
+	logger.Info("Deleting metrics from Pushgateway: ", p.groupURL())
+	return p.do(context.Background(), http.MethodDelete, nil)
+}
+
+func (p *Pushgateway) pushAndLog(st *store.Store, keys []string) {
+	if err := p.push(context.Background(), st, keys); err != nil {
+		logger.Error("Cannot push metrics to Pushgateway: ", err)
+	}
+}
+
+// push sends the payloads in the Prometheus text format.
+// Other formats are skipped, since the Pushgateway does not accept them
+func (p *Pushgateway) push(ctx context.Context, st *store.Store, keys []string) error {
+	textKeys, _ := negotiate("", keys)
+	var body bytes.Buffer
+	for _, key := range textKeys {
+		payload, ok := st.Payload(key)
+		if !ok {
+			logger.Warn("No metrics to push in the store with key: ", key)
+			continue
+		}
+		body.Write(payload)
+	}
+	return p.do(ctx, p.cfg.Method, body.Bytes())
+}
+
+func (p *Pushgateway) do(ctx context.Context, method string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, p.groupURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if method != http.MethodDelete {
+		req.Header.Set("Content-Type", textContentType)
+	}
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPush, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:errcheck
+		return fmt.Errorf("%w: %s: %s", ErrPush, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// groupURL returns the URL of the group:
+// /metrics/job/<job>{/<label>/<value>} with the labels sorted by name
+func (p *Pushgateway) groupURL() string {
+	var b strings.Builder
+	b.WriteString(p.cfg.URL)
+	b.WriteString("/metrics")
+	writeGroupingLabel(&b, "job", p.cfg.Job)
+	names := make([]string, 0, len(p.cfg.Grouping))
+	for name := range p.cfg.Grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeGroupingLabel(&b, name, p.cfg.Grouping[name])
+	}
+	return b.String()
+}
+
+// writeGroupingLabel writes the label as a path segment.
+// Values, which cannot be a path segment, are base64 encoded
+func writeGroupingLabel(b *strings.Builder, name, value string) {
+	switch {
+	case value == "":
+		// An empty value is a single `=` in the base64 form
+		fmt.Fprintf(b, "/%s@base64/=", name)
+	case strings.Contains(value, "/"):
+		fmt.Fprintf(b, "/%s@base64/%s", name, base64.RawURLEncoding.EncodeToString([]byte(value)))
+	default:
+		fmt.Fprintf(b, "/%s/%s", name, url.PathEscape(value))
+	}
+}
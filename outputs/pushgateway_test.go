@@ -0,0 +1,93 @@
+package outputs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grem11n/cost-exporter/converters"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPushgateway(t *testing.T) {
+	p, err := NewPushgateway(PushgatewayConfig{URL: "http://pushgateway:9091/", Method: "post"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPost, p.cfg.Method)
+	assert.Equal(t, "http://pushgateway:9091/metrics/job/cost-exporter", p.groupURL())
+
+	_, err = NewPushgateway(PushgatewayConfig{URL: "http://pushgateway:9091", Method: "patch"})
+	assert.ErrorIs(t, err, ErrPush)
+	_, err = NewPushgateway(PushgatewayConfig{})
+	assert.ErrorIs(t, err, ErrPush)
+}
+
+func TestPushgatewayGroupURL(t *testing.T) {
+	p, err := NewPushgateway(PushgatewayConfig{
+		URL:      "http://pushgateway:9091",
+		Job:      "costs",
+		Grouping: map[string]string{"path": "/var/tmp", "env": "prod", "empty": ""},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"http://pushgateway:9091/metrics/job/costs/empty@base64/=/env/prod/path@base64/L3Zhci90bXA",
+		p.groupURL())
+}
+
+func TestPushgatewayPush(t *testing.T) {
+	var method, contentType, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		contentType = r.Header.Get("Content-Type")
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		body = string(b)
+		assert.Equal(t, "/metrics/job/cost-exporter/env/prod", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	p, err := NewPushgateway(PushgatewayConfig{URL: srv.URL, Grouping: map[string]string{"env": "prod"}, DeleteOnShutdown: true})
+	assert.NoError(t, err)
+	// OpenMetrics has timestamps, which the Pushgateway does not accept
+	keys := []string{converters.PrometheusName, converters.OpenMetricsName, internalKey}
+	assert.NoError(t, p.PublishOnce(testStore(), keys))
+	assert.Equal(t, http.MethodPut, method)
+	assert.Equal(t, textContentType, contentType)
+	assert.Equal(t, "aws_ce_cost 1\ncost_exporter_aws_calls_total 3\n", body)
+
+	assert.NoError(t, p.Close())
+	assert.Equal(t, http.MethodDelete, method)
+}
+
+func TestPushgatewayPushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "pushed metrics are invalid or inconsistent", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	p, err := NewPushgateway(PushgatewayConfig{URL: srv.URL})
+	assert.NoError(t, err)
+	err = p.PublishOnce(testStore(), []string{converters.PrometheusName})
+	assert.ErrorIs(t, err, ErrPush)
+	assert.Contains(t, err.Error(), "inconsistent")
+	// Nothing is deleted unless delete_on_shutdown is set
+	assert.NoError(t, p.Close())
+}
+
+func TestPushgatewayPublishOnceRequiresPrometheus(t *testing.T) {
+	var pushed bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		pushed = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	p, err := NewPushgateway(PushgatewayConfig{URL: srv.URL})
+	assert.NoError(t, err)
+	// Only the internal metrics would be pushed
+	assert.ErrorIs(t, p.PublishOnce(testStore(), []string{converters.OpenMetricsName, internalKey}), ErrPush)
+	assert.ErrorIs(t, p.PublishOnce(store.New(store.Config{}), []string{converters.PrometheusName}), ErrPush)
+	assert.False(t, pushed)
+}
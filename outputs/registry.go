@@ -1,15 +1,61 @@
 package outputs
 
 import (
-	"sync"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/mitchellh/mapstructure"
 )
 
 // OutputConfig contains the config for each Output
 type OutputConfig any
 
+// Subscription is a part of the output config shared by all the outputs
+type Subscription struct {
+	// Converters to publish the metrics from.
+	// Metrics from all the converters are published if empty
+	Converters []string `mapstructure:"converters,omitempty"`
+}
+
 // Output an interface to output the collected metrics
 type Output interface {
-	Publish(*sync.Map, []string)
+	Publish(*store.Store, []string)
+}
+
+// OncePublisher is implemented by the outputs, which can publish the metrics a single time
+// in the one-shot run mode, e.g. push them to a remote endpoint
+type OncePublisher interface {
+	PublishOnce(*store.Store, []string) error
+}
+
+// Closer is implemented by the outputs, which need to clean up on shutdown
+type Closer interface {
+	Close() error
+}
+
+// decodeOutputConfig decodes the output config into cfg.
+// Durations are decoded from strings, e.g. `30s`
+func decodeOutputConfig(conf OutputConfig, cfg any) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     cfg,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(conf)
+}
+
+// watchPayload calls fn with the payload of the key every time it is converted.
+// The converter may have put the payload before the subscription, so it is passed to fn first
+func watchPayload(st *store.Store, key string, fn func([]byte)) {
+	events := st.SubscribePayloads(key)
+	if payload, ok := st.Payload(key); ok {
+		fn(payload)
+	}
+	for range events {
+		if payload, ok := st.Payload(key); ok {
+			fn(payload)
+		}
+	}
 }
 
 type OutputFactory func(OutputConfig) Output //nolint:revive
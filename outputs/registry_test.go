@@ -0,0 +1,42 @@
+package outputs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeOutputConfig(t *testing.T) {
+	var cfg InfluxDBConfig
+	err := decodeOutputConfig(map[string]any{"url": "http://localhost:8086", "timeout": "5s"}, &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, InfluxDBConfig{URL: "http://localhost:8086", Timeout: 5 * time.Second}, cfg)
+
+	assert.Error(t, decodeOutputConfig(map[string]any{"timeout": "soon"}, &cfg))
+}
+
+func TestWatchPayload(t *testing.T) {
+	st := store.New(store.Config{})
+	// The payload put before the subscription is passed too
+	st.PutPayload("test", []byte("1"))
+	got := make(chan string, 10)
+	go watchPayload(st, "test", func(payload []byte) { got <- string(payload) })
+	assert.Equal(t, "1", waitPayload(t, got))
+
+	st.PutPayload("other", []byte("other"))
+	st.PutPayload("test", []byte("2"))
+	assert.Equal(t, "2", waitPayload(t, got))
+}
+
+func waitPayload(t *testing.T, got chan string) string {
+	t.Helper()
+	select {
+	case payload := <-got:
+		return payload
+	case <-time.After(time.Second):
+		t.Fatal("payload was not passed")
+		return ""
+	}
+}
@@ -0,0 +1,195 @@
+// This file implements the remote write output:
+// It pushes the remote write requests from the remote_write converter
+// to a Prometheus compatible endpoint, e.g. Mimir, Thanos or VictoriaMetrics
+package outputs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/grem11n/cost-exporter/converters"
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/grem11n/cost-exporter/internal/remotewrite"
+	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
+)
+
+// RemoteWriteConfig of the remote write output
+type RemoteWriteConfig struct {
+	remotewrite.Config `mapstructure:",squash"`
+	// Max number of the time series per request
+	BatchSize int `mapstructure:"batch_size,omitempty"`
+	// Max number of the requests waiting to be sent. The oldest one is dropped when the queue is full
+	QueueSize int `mapstructure:"queue_size,omitempty"`
+	// Failed requests are retried with the exponential backoff between min_backoff and max_backoff
+	MinBackoff time.Duration `mapstructure:"min_backoff,omitempty"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff,omitempty"`
+}
+
+// RemoteWrite output
+type RemoteWrite struct {
+	cfg    RemoteWriteConfig
+	client sender
+	queue  chan []byte
+}
+
+type sender interface {
+	Send(ctx context.Context, writeRequest []byte) error
+}
+
+const (
+	defaultRemoteWriteQueueSize  = 10
+	defaultRemoteWriteMinBackoff = 1 * time.Second
+	defaultRemoteWriteMaxBackoff = 5 * time.Minute
+	remoteWriteSentName          = "cost_exporter_output_requests_total{job=\"cost-exporter\",output=\"remote_write\"}"
+	remoteWriteFailedName        = "cost_exporter_output_failed_batches_total{job=\"cost-exporter\",output=\"remote_write\"}"
+)
+
+var (
+	remoteWriteSent   *metrics.Counter
+	remoteWriteFailed *metrics.Counter
+)
+
+func init() {
+	logger.Info("Initializing remote write output")
+	Register("remote_write", func(conf OutputConfig) Output {
+		var cfg RemoteWriteConfig
+		if err := decodeOutputConfig(conf, &cfg); err != nil {
+			logger.Fatal("Unable to decode remote write config: ", err)
+		}
+		if cfg.URL == "" {
+			logger.Fatal("Remote write output requires the url")
+		}
+		return NewRemoteWrite(cfg, remotewrite.NewClient(cfg.Config))
+	})
+	remoteWriteSent = intmetrics.InternalMetricsSet.GetOrCreateCounter(remoteWriteSentName)
+	remoteWriteFailed = intmetrics.InternalMetricsSet.GetOrCreateCounter(remoteWriteFailedName)
+}
+
+// NewRemoteWrite returns the remote write output with the defaults set
+func NewRemoteWrite(cfg RemoteWriteConfig, client sender) *RemoteWrite {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = remotewrite.DefaultBatchSize
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultRemoteWriteQueueSize
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultRemoteWriteMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(defaultRemoteWriteMaxBackoff, cfg.MinBackoff)
+	}
+	return &RemoteWrite{cfg: cfg, client: client, queue: make(chan []byte, cfg.QueueSize)}
+}
+
+// Publish queues the remote write request every time it is converted and sends the queued requests in order.
+// Only the remote_write converter payload is sent, other keys are not in the protobuf format
+func (r *RemoteWrite) Publish(st *store.Store, keys []string) {
+	if !slices.Contains(keys, converters.RemoteWriteName) {
+		logger.Error("Remote write output requires the converter: ", converters.RemoteWriteName)
+		return
+	}
+	logger.Info("Writing metrics to the remote write endpoint: ", r.cfg.URL)
+	go r.run(context.Background())
+	watchPayload(st, converters.RemoteWriteName, r.enqueue)
+}
+
+// PublishOnce sends the current remote write request a single time.
+// Failed batches are retried for up to max_backoff
+func (r *RemoteWrite) PublishOnce(st *store.Store, keys []string) error {
+	if !slices.Contains(keys, converters.RemoteWriteName) {
+		return fmt.Errorf("%w: the %s converter is required", remotewrite.ErrWrite, converters.RemoteWriteName)
+	}
+	payload, ok := st.Payload(converters.RemoteWriteName)
+	if !ok {
+		return fmt.Errorf("%w: no metrics to write", remotewrite.ErrWrite)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.MaxBackoff)
+	defer cancel()
+	return r.write(ctx, payload)
+}
+
+// enqueue adds the request to the queue. The oldest request is dropped if the queue is full,
+// e.g. when the endpoint is down for a long time
+func (r *RemoteWrite) enqueue(req []byte) {
+	for {
+		select {
+		case r.queue <- req:
+			return
+		default:
+		}
+		select {
+		case <-r.queue:
+			remoteWriteFailed.Inc()
+			logger.Warn("Remote write queue is full, dropping the oldest request")
+		default:
+		}
+	}
+}
+
+func (r *RemoteWrite) run(ctx context.Context) {
+	for req := range r.queue {
+		if err := r.write(ctx, req); err != nil {
+			logger.Error("Cannot write metrics to the remote write endpoint: ", err)
+		}
+	}
+}
+
+// write sends the request in batches of the time series.
+// Failed batches are skipped, so the others are still sent
+func (r *RemoteWrite) write(ctx context.Context, req []byte) error {
+	series, err := remotewrite.Series(req)
+	if err != nil {
+		remoteWriteFailed.Inc()
+		return fmt.Errorf("cannot split the remote write request: %w", err)
+	}
+	var errs []error
+	for start := 0; start < len(series); start += r.cfg.BatchSize {
+		end := min(start+r.cfg.BatchSize, len(series))
+		if err := r.send(ctx, series[start:end]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send sends the batch of the marshaled time series until it succeeds.
+// Only recoverable errors are retried. If the endpoint rejects the batch,
+// because of a new value of an existing sample or a sample too old for it, the batch is split in halves,
+// so the other time series are written and only the rejected ones are dropped
+func (r *RemoteWrite) send(ctx context.Context, series [][]byte) error {
+	req := bytes.Join(series, nil)
+	backoff := r.cfg.MinBackoff
+	for {
+		err := r.client.Send(ctx, req)
+		if err == nil {
+			remoteWriteSent.Inc()
+			return nil
+		}
+		if errors.Is(err, remotewrite.ErrDuplicateSample) || errors.Is(err, remotewrite.ErrOldSample) {
+			if len(series) > 1 {
+				return errors.Join(r.send(ctx, series[:len(series)/2]), r.send(ctx, series[len(series)/2:]))
+			}
+			logger.Warn("Remote write endpoint rejected a sample of the time series: ", err)
+			return nil
+		}
+		if !errors.Is(err, remotewrite.ErrRecoverable) {
+			remoteWriteFailed.Inc()
+			return err
+		}
+		logger.Warnf("Remote write failed, retrying in %s: %s", backoff, err)
+		select {
+		case <-ctx.Done():
+			remoteWriteFailed.Inc()
+			return fmt.Errorf("%w: %w", err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, r.cfg.MaxBackoff)
+	}
+}
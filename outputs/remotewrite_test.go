@@ -0,0 +1,197 @@
+package outputs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/grem11n/cost-exporter/converters"
+	"github.com/grem11n/cost-exporter/internal/remotewrite"
+	"github.com/grem11n/cost-exporter/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSender struct {
+	errs []error
+	sent [][]byte
+}
+
+func (f *fakeSender) Send(_ context.Context, req []byte) error {
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	f.sent = append(f.sent, req)
+	return nil
+}
+
+func TestRemoteWriteEnqueueDropsOldest(t *testing.T) {
+	r := NewRemoteWrite(RemoteWriteConfig{QueueSize: 2}, &fakeSender{})
+	r.enqueue([]byte("1"))
+	r.enqueue([]byte("2"))
+	r.enqueue([]byte("3"))
+	assert.Equal(t, []byte("2"), <-r.queue)
+	assert.Equal(t, []byte("3"), <-r.queue)
+}
+
+func TestRemoteWriteSendRetries(t *testing.T) {
+	s := &fakeSender{errs: []error{
+		fmt.Errorf("%w: %w", remotewrite.ErrRecoverable, remotewrite.ErrWrite),
+		fmt.Errorf("%w: %w", remotewrite.ErrRecoverable, remotewrite.ErrWrite),
+	}}
+	r := NewRemoteWrite(RemoteWriteConfig{MinBackoff: time.Millisecond}, s)
+	assert.NoError(t, r.send(context.Background(), [][]byte{[]byte("req")}))
+	assert.Equal(t, [][]byte{[]byte("req")}, s.sent)
+	assert.Empty(t, s.errs)
+
+	// Rejected requests are dropped
+	s = &fakeSender{errs: []error{remotewrite.ErrWrite}}
+	r = NewRemoteWrite(RemoteWriteConfig{MinBackoff: time.Millisecond}, s)
+	assert.ErrorIs(t, r.send(context.Background(), [][]byte{[]byte("req")}), remotewrite.ErrWrite)
+	assert.Empty(t, s.sent)
+
+	// Retries stop when the context is done
+	s = &fakeSender{errs: []error{fmt.Errorf("%w: %w", remotewrite.ErrRecoverable, remotewrite.ErrWrite)}}
+	r = NewRemoteWrite(RemoteWriteConfig{MinBackoff: time.Minute}, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, r.send(ctx, [][]byte{[]byte("req")}), context.Canceled)
+	assert.Empty(t, s.sent)
+}
+
+func testWriteRequest(names ...string) []byte {
+	series := []remotewrite.TimeSeries{}
+	for _, name := range names {
+		series = append(series, remotewrite.NewTimeSeries(name, nil, remotewrite.Sample{Value: 1, Timestamp: 1000}))
+	}
+	return remotewrite.Marshal(series)
+}
+
+func TestRemoteWriteBatches(t *testing.T) {
+	s := &fakeSender{}
+	assert.NoError(t, NewRemoteWrite(RemoteWriteConfig{BatchSize: 2}, s).write(context.Background(), testWriteRequest("a", "b", "c")))
+	assert.Equal(t, [][]byte{testWriteRequest("a", "b"), testWriteRequest("c")}, s.sent)
+}
+
+// duplicateSender rejects the requests with the duplicate time series like Prometheus
+type duplicateSender struct {
+	duplicate []byte
+	sent      [][]byte
+}
+
+func (d *duplicateSender) Send(_ context.Context, req []byte) error {
+	if bytes.Contains(req, d.duplicate) {
+		return fmt.Errorf("%w: %w", remotewrite.ErrDuplicateSample, remotewrite.ErrWrite)
+	}
+	d.sent = append(d.sent, req)
+	return nil
+}
+
+func TestRemoteWriteSendDuplicate(t *testing.T) {
+	s := &duplicateSender{duplicate: testWriteRequest("b")}
+	assert.NoError(t, NewRemoteWrite(RemoteWriteConfig{}, s).write(context.Background(), testWriteRequest("a", "b", "c", "d")))
+	// Only the duplicate time series is dropped
+	assert.Equal(t, [][]byte{testWriteRequest("a"), testWriteRequest("c", "d")}, s.sent)
+}
+
+func TestRemoteWriteSendOldSample(t *testing.T) {
+	old := testWriteRequest("old")
+	var received [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		decoded, err := snappy.Decode(nil, body)
+		assert.NoError(t, err)
+		// Like Prometheus, which rejects the whole request with a sample before the head block
+		if bytes.Contains(decoded, old) {
+			http.Error(w, "out of bounds", http.StatusBadRequest)
+			return
+		}
+		received = append(received, decoded)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	r := NewRemoteWrite(RemoteWriteConfig{}, remotewrite.NewClient(remotewrite.Config{URL: srv.URL}))
+	assert.NoError(t, r.write(context.Background(), testWriteRequest("a", "old", "c", "d")))
+	// Only the old time series is dropped
+	assert.Equal(t, [][]byte{testWriteRequest("a"), testWriteRequest("c", "d")}, received)
+}
+
+func TestRemoteWritePublishOnce(t *testing.T) {
+	s := &fakeSender{}
+	r := NewRemoteWrite(RemoteWriteConfig{BatchSize: 2}, s)
+	st := store.New(store.Config{})
+	assert.ErrorIs(t, r.PublishOnce(st, []string{converters.RemoteWriteName}), remotewrite.ErrWrite)
+	assert.ErrorIs(t, r.PublishOnce(st, []string{converters.PrometheusName}), remotewrite.ErrWrite)
+
+	st.PutPayload(converters.RemoteWriteName, testWriteRequest("a", "b", "c"))
+	assert.NoError(t, r.PublishOnce(st, []string{converters.RemoteWriteName}))
+	assert.Equal(t, [][]byte{testWriteRequest("a", "b"), testWriteRequest("c")}, s.sent)
+
+	// Rejected batches fail the run, the others are still sent
+	s = &fakeSender{errs: []error{remotewrite.ErrWrite}}
+	r = NewRemoteWrite(RemoteWriteConfig{BatchSize: 2}, s)
+	assert.ErrorIs(t, r.PublishOnce(st, []string{converters.RemoteWriteName}), remotewrite.ErrWrite)
+	assert.Equal(t, [][]byte{testWriteRequest("c")}, s.sent)
+}
+
+func TestRemoteWriteSendEndpoint(t *testing.T) {
+	req := remotewrite.Marshal([]remotewrite.TimeSeries{
+		remotewrite.NewTimeSeries("aws_ce_unblended_cost", nil, remotewrite.Sample{Value: 1, Timestamp: 1000}),
+	})
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "finops", r.Header.Get("X-Scope-OrgID"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		decoded, err := snappy.Decode(nil, body)
+		assert.NoError(t, err)
+		assert.Equal(t, req, decoded)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg := RemoteWriteConfig{
+		Config: remotewrite.Config{
+			URL:         srv.URL,
+			Headers:     map[string]string{"X-Scope-OrgID": "finops"},
+			BearerToken: "token",
+		},
+		MinBackoff: time.Millisecond,
+	}
+	NewRemoteWrite(cfg, remotewrite.NewClient(cfg.Config)).write(context.Background(), req)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRemoteWriteConfig(t *testing.T) {
+	output := GetOutput("remote_write")(map[string]any{
+		"url":          "http://mimir:9009/api/v1/push",
+		"basic_auth":   map[string]any{"username": "finops", "password": "secret"},
+		"queue_size":   5,
+		"min_backoff":  "2s",
+		"converters":   []string{"remote_write"},
+		"bearer_token": "",
+	})
+	r, ok := output.(*RemoteWrite)
+	assert.True(t, ok)
+	assert.Equal(t, "http://mimir:9009/api/v1/push", r.cfg.URL)
+	assert.Equal(t, &remotewrite.BasicAuth{Username: "finops", Password: "secret"}, r.cfg.BasicAuth)
+	assert.Equal(t, 5, cap(r.queue))
+	assert.Equal(t, remotewrite.DefaultBatchSize, r.cfg.BatchSize)
+	assert.Equal(t, 2*time.Second, r.cfg.MinBackoff)
+	assert.Equal(t, defaultRemoteWriteMaxBackoff, r.cfg.MaxBackoff)
+}
@@ -5,10 +5,10 @@ package probes
 import (
 	"fmt"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/grem11n/cost-exporter/logger"
+	"github.com/grem11n/cost-exporter/store"
 )
 
 const (
@@ -24,7 +24,7 @@ type Probes struct {
 	LivenessProbeEndpoint  string `mapstructure:"liveness,omitempty"`
 	ReadinessProbeEndpoint string `mapstructure:"readiness,omitempty"`
 	StartupProbeEndpoint   string `mapstructure:"startup,omitempty"`
-	Cache                  *sync.Map
+	Store                  *store.Store
 }
 
 // ProbeConfig stores configuration for K8s probes
@@ -36,7 +36,7 @@ type ProbeConfig struct {
 }
 
 // New returns a pointer to a Probes instance
-func New(conf *ProbeConfig, cache *sync.Map) *Probes {
+func New(conf *ProbeConfig, st *store.Store) *Probes {
 	// Check if probes' endpoints are not empty
 	livenessProbeEndpoint := conf.LivenessProbeEndpoint
 	if livenessProbeEndpoint == "" {
@@ -64,7 +64,7 @@ func New(conf *ProbeConfig, cache *sync.Map) *Probes {
 		LivenessProbeEndpoint:  livenessProbeEndpoint,
 		ReadinessProbeEndpoint: readinessProbeEndpoint,
 		StartupProbeEndpoint:   startupProbeEndpoint,
-		Cache:                  cache,
+		Store:                  st,
 	}
 }
 
@@ -94,14 +94,10 @@ func (p *Probes) livenessProbe(w http.ResponseWriter, _ *http.Request) {
 func (p *Probes) readinessProbe(w http.ResponseWriter, _ *http.Request) {
 	code := 200
 	message := "OK"
-	p.Cache.Range(func(key, _ any) bool {
-		if key == nil {
-			code = 503
-			message = "503 - Metrics cache is empty"
-			return false
-		}
-		return true
-	})
+	if p.Store.Empty() {
+		code = 503
+		message = "503 - Metrics store is empty"
+	}
 	w.WriteHeader(code)
 	if _, err := w.Write([]byte(message)); err != nil {
 		logger.Error("ReadinessProbe write error: ", err)
@@ -0,0 +1,294 @@
+// Package store implements the exchange point between
+// clients, converters and outputs
+package store
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+)
+
+const (
+	evictedReplacedName = "cost_exporter_store_evicted_series_total{job=\"cost-exporter\",reason=\"replaced\"}"
+	evictedTTLName      = "cost_exporter_store_evicted_series_total{job=\"cost-exporter\",reason=\"ttl\"}"
+	// How often to look for the expired sources at most
+	maxEvictionInterval = 1 * time.Minute
+)
+
+var (
+	ErrTTL = errors.New("the store TTL must be longer than the refresh interval")
+
+	evictedReplaced = intmetrics.InternalMetricsSet.GetOrCreateCounter(evictedReplacedName)
+	evictedTTL      = intmetrics.InternalMetricsSet.GetOrCreateCounter(evictedTTLName)
+)
+
+// Config of the store
+type Config struct {
+	// TTL after which the metrics of a source, which is not refreshed, are dropped.
+	// Metrics are kept until the next refresh if it is not set
+	TTL time.Duration `mapstructure:"ttl,omitempty"`
+}
+
+// Validate checks that the metrics are not dropped before they are refreshed
+func (c Config) Validate(refresh time.Duration) error {
+	if c.TTL > 0 && c.TTL <= refresh {
+		return fmt.Errorf("%w: %s <= %s", ErrTTL, c.TTL, refresh)
+	}
+	return nil
+}
+
+// Store keeps the raw metrics of the clients grouped by namespace and source,
+// e.g. a query of an account, and the converted payloads, e.g. Prometheus text.
+// Each batch of the source metrics is replaced atomically,
+// so readers never see a partially refreshed source
+type Store struct {
+	ttl      time.Duration
+	mu       sync.RWMutex
+	sources  map[sourceKey]*batch
+	payloads map[string][]byte
+	subs     []*subscription
+	// Subscribers of the payloads
+	payloadSubs []*subscription
+}
+
+// Event notifies the subscribers about the updated source.
+// Payload events have the payload key as the Source
+type Event struct {
+	Namespace string
+	Source    string
+	Time      time.Time
+}
+
+type sourceKey struct {
+	namespace string
+	source    string
+}
+
+type batch struct {
+	updated time.Time
+	metrics []intmetrics.Metric
+	index   map[string]int // series key to the metric index
+}
+
+type subscription struct {
+	// Namespaces or payload keys to watch. All of them if empty
+	filter []string
+	ch     chan Event
+}
+
+func New(cfg Config) *Store {
+	return &Store{
+		ttl:      cfg.TTL,
+		sources:  map[sourceKey]*batch{},
+		payloads: map[string][]byte{},
+	}
+}
+
+// Put replaces all the metrics of the source in the namespace,
+// so the series missing from the new batch are dropped.
+// Metrics with the same name and tags are deduplicated, the last one wins
+func (s *Store) Put(namespace, source string, metrics []intmetrics.Metric) {
+	b := &batch{updated: time.Now(), index: map[string]int{}}
+	for _, m := range metrics {
+		m.Tags = maps.Clone(m.Tags)
+		if m.Tags == nil {
+			m.Tags = map[string]string{}
+		}
+		m.AddDefaultTags()
+		key := seriesKey(m)
+		if i, ok := b.index[key]; ok {
+			b.metrics[i] = m
+			continue
+		}
+		b.index[key] = len(b.metrics)
+		b.metrics = append(b.metrics, m)
+	}
+
+	key := sourceKey{namespace: namespace, source: source}
+	s.mu.Lock()
+	if prev, ok := s.sources[key]; ok {
+		evictedReplaced.Add(prev.missingFrom(b))
+	}
+	s.sources[key] = b
+	subs := s.subs
+	s.mu.Unlock()
+
+	s.notify(subs, Event{Namespace: namespace, Source: source, Time: b.updated})
+}
+
+// Run drops the expired sources periodically if the TTL is set
+func (s *Store) Run() {
+	if s.ttl <= 0 {
+		return
+	}
+	interval := evictionInterval(s.ttl)
+	for {
+		time.Sleep(interval)
+		s.evict(time.Now())
+	}
+}
+
+// evictionInterval is a half of the TTL, but at most maxEvictionInterval,
+// so the expired sources are not kept much longer than the TTL
+func evictionInterval(ttl time.Duration) time.Duration {
+	return min(ttl/2, maxEvictionInterval)
+}
+
+// evict drops the sources, which have not been refreshed within the TTL
+func (s *Store) evict(now time.Time) {
+	events := []Event{}
+	s.mu.Lock()
+	for key, b := range s.sources {
+		if now.Sub(b.updated) <= s.ttl {
+			continue
+		}
+		delete(s.sources, key)
+		evictedTTL.Add(len(b.metrics))
+		events = append(events, Event{Namespace: key.namespace, Source: key.source, Time: now})
+	}
+	subs := s.subs
+	s.mu.Unlock()
+
+	for _, event := range events {
+		s.notify(subs, event)
+	}
+}
+
+func (s *Store) notify(subs []*subscription, event Event) {
+	for _, sub := range subs {
+		sub.notify(event.Namespace, event)
+	}
+}
+
+// Snapshot returns a consistent copy of the metrics from the namespaces.
+// Metrics from all the namespaces are returned if none are given
+func (s *Store) Snapshot(namespaces ...string) []intmetrics.Metric {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]sourceKey, 0, len(s.sources))
+	for k := range s.sources {
+		if len(namespaces) == 0 || slices.Contains(namespaces, k.namespace) {
+			keys = append(keys, k)
+		}
+	}
+	// Keep the order stable between snapshots
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].namespace != keys[j].namespace {
+			return keys[i].namespace < keys[j].namespace
+		}
+		return keys[i].source < keys[j].source
+	})
+	res := []intmetrics.Metric{}
+	for _, k := range keys {
+		for _, m := range s.sources[k].metrics {
+			m.Tags = maps.Clone(m.Tags)
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// Count returns the number of the metrics in the namespaces.
+// All the namespaces are counted if none are given
+func (s *Store) Count(namespaces ...string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	count := 0
+	for k, b := range s.sources {
+		if len(namespaces) == 0 || slices.Contains(namespaces, k.namespace) {
+			count += len(b.metrics)
+		}
+	}
+	return count
+}
+
+// Subscribe returns a channel, which receives an event when a source
+// in one of the namespaces is updated. All the namespaces are watched if none are given.
+// Events are coalesced: if the subscriber is busy, it gets
+// the earliest pending event only, so it has to read the whole snapshot
+func (s *Store) Subscribe(namespaces ...string) <-chan Event {
+	sub := &subscription{filter: namespaces, ch: make(chan Event, 1)}
+	s.mu.Lock()
+	// Copy on write, since the subscribers are read without the lock
+	s.subs = append(s.subs[:len(s.subs):len(s.subs)], sub)
+	s.mu.Unlock()
+	return sub.ch
+}
+
+// SubscribePayloads returns a channel, which receives an event when one of the payloads is updated.
+// All the payloads are watched if no keys are given. Events are coalesced the same way as in Subscribe
+func (s *Store) SubscribePayloads(keys ...string) <-chan Event {
+	sub := &subscription{filter: keys, ch: make(chan Event, 1)}
+	s.mu.Lock()
+	s.payloadSubs = append(s.payloadSubs[:len(s.payloadSubs):len(s.payloadSubs)], sub)
+	s.mu.Unlock()
+	return sub.ch
+}
+
+// PutPayload stores the converted metrics under the key, e.g. the converter name
+func (s *Store) PutPayload(key string, payload []byte) {
+	s.mu.Lock()
+	s.payloads[key] = payload
+	subs := s.payloadSubs
+	s.mu.Unlock()
+
+	event := Event{Source: key, Time: time.Now()}
+	for _, sub := range subs {
+		sub.notify(key, event)
+	}
+}
+
+// Payload returns the converted metrics by the key
+func (s *Store) Payload(key string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	payload, ok := s.payloads[key]
+	return payload, ok
+}
+
+// Empty reports whether there are neither metrics nor payloads in the store
+func (s *Store) Empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sources) == 0 && len(s.payloads) == 0
+}
+
+// missingFrom returns the number of the series, which are not in the next batch
+func (b *batch) missingFrom(next *batch) int {
+	missing := 0
+	for key := range b.index {
+		if _, ok := next.index[key]; !ok {
+			missing++
+		}
+	}
+	return missing
+}
+
+// notify sends the event if the subscriber watches the name
+func (sub *subscription) notify(name string, event Event) {
+	if len(sub.filter) > 0 && !slices.Contains(sub.filter, name) {
+		return
+	}
+	select {
+	case sub.ch <- event:
+	default:
+		// There is a pending event already
+	}
+}
+
+// seriesKey identifies the series within the source
+func seriesKey(m intmetrics.Metric) string {
+	tags := make([]string, 0, len(m.Tags))
+	for k, v := range m.Tags {
+		tags = append(tags, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(tags)
+	return fmt.Sprintf("%s_%s_%s_%s", m.Query, m.Prefix, m.Name, strings.Join(tags, "_"))
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	intmetrics "github.com/grem11n/cost-exporter/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMetrics(values ...float64) []intmetrics.Metric {
+	res := []intmetrics.Metric{}
+	for i, v := range values {
+		res = append(res, intmetrics.Metric{
+			Name:   "UnblendedCost",
+			Prefix: "aws_ce",
+			Query:  "daily",
+			Value:  v,
+			Tags:   map[string]string{"service": string(rune('a' + i))},
+		})
+	}
+	return res
+}
+
+func TestPutReplacesSource(t *testing.T) {
+	st := New(Config{})
+	st.Put("aws", "payer/daily", testMetrics(1, 2, 3))
+	st.Put("aws", "payer/monthly", testMetrics(4))
+	assert.Len(t, st.Snapshot(), 4)
+
+	// The whole source is replaced
+	st.Put("aws", "payer/daily", testMetrics(5))
+	got := st.Snapshot("aws")
+	assert.Len(t, got, 2)
+	assert.InDelta(t, 5.0, got[0].Value, 0.0001)
+	assert.Equal(t, "cost-exporter", got[0].Tags["job"])
+}
+
+func TestPutDeduplicates(t *testing.T) {
+	st := New(Config{})
+	metrics := append(testMetrics(1), testMetrics(2)...)
+	st.Put("aws", "payer/daily", metrics)
+	got := st.Snapshot()
+	assert.Len(t, got, 1)
+	assert.InDelta(t, 2.0, got[0].Value, 0.0001)
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	st := New(Config{})
+	metrics := testMetrics(1)
+	st.Put("aws", "payer/daily", metrics)
+	// Neither the caller nor the readers can change the stored metrics
+	metrics[0].Tags["service"] = "changed"
+	snapshot := st.Snapshot()
+	snapshot[0].Tags["service"] = "changed"
+	assert.Equal(t, "a", st.Snapshot()[0].Tags["service"])
+}
+
+func TestSnapshotNamespaces(t *testing.T) {
+	st := New(Config{})
+	st.Put("aws", "payer/daily", testMetrics(1))
+	st.Put("gcp", "billing", testMetrics(2, 3))
+	assert.Len(t, st.Snapshot("aws"), 1)
+	assert.Len(t, st.Snapshot("gcp"), 2)
+	assert.Len(t, st.Snapshot("aws", "gcp"), 3)
+	assert.Empty(t, st.Snapshot("azure"))
+}
+
+func TestSubscribe(t *testing.T) {
+	st := New(Config{})
+	aws := st.Subscribe("aws")
+	all := st.Subscribe()
+
+	st.Put("gcp", "billing", testMetrics(1))
+	st.Put("aws", "payer/daily", testMetrics(1))
+	// Events are coalesced
+	st.Put("aws", "payer/monthly", testMetrics(1))
+
+	event := <-aws
+	assert.Equal(t, "aws", event.Namespace)
+	assert.Equal(t, "payer/daily", event.Source)
+	assert.Empty(t, aws)
+
+	event = <-all
+	assert.Equal(t, "gcp", event.Namespace)
+	assert.Empty(t, all)
+}
+
+func TestPayloads(t *testing.T) {
+	st := New(Config{})
+	assert.True(t, st.Empty())
+	_, ok := st.Payload("prometheus")
+	assert.False(t, ok)
+
+	st.PutPayload("prometheus", []byte("up 1\n"))
+	got, ok := st.Payload("prometheus")
+	assert.True(t, ok)
+	assert.Equal(t, "up 1\n", string(got))
+	assert.False(t, st.Empty())
+}
+
+func TestPutCountsReplacedSeries(t *testing.T) {
+	st := New(Config{})
+	before := evictedReplaced.Get()
+	st.Put("aws", "payer/daily", testMetrics(1, 2, 3))
+	// A group has disappeared from the results
+	st.Put("aws", "payer/daily", testMetrics(1, 2))
+	assert.Len(t, st.Snapshot(), 2)
+	assert.Equal(t, before+1, evictedReplaced.Get())
+}
+
+func TestEvict(t *testing.T) {
+	st := New(Config{TTL: time.Hour})
+	st.Put("aws", "payer/daily", testMetrics(1, 2))
+	events := st.Subscribe()
+	before := evictedTTL.Get()
+
+	st.evict(time.Now().Add(30 * time.Minute))
+	assert.Len(t, st.Snapshot(), 2)
+	assert.Empty(t, events)
+
+	st.evict(time.Now().Add(2 * time.Hour))
+	assert.Empty(t, st.Snapshot())
+	assert.Equal(t, before+2, evictedTTL.Get())
+	event := <-events
+	assert.Equal(t, "payer/daily", event.Source)
+}
+
+func TestEvictionInterval(t *testing.T) {
+	assert.Equal(t, 10*time.Second, evictionInterval(20*time.Second))
+	assert.Equal(t, maxEvictionInterval, evictionInterval(72*time.Hour))
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{}.Validate(24*time.Hour))
+	assert.NoError(t, Config{TTL: 72 * time.Hour}.Validate(24*time.Hour))
+	assert.ErrorIs(t, Config{TTL: 24 * time.Hour}.Validate(24*time.Hour), ErrTTL)
+	assert.ErrorIs(t, Config{TTL: 30 * time.Minute}.Validate(time.Hour), ErrTTL)
+}
+
+func TestSubscribePayloads(t *testing.T) {
+	st := New(Config{})
+	influx := st.SubscribePayloads("influx")
+	st.PutPayload("prometheus", []byte("up 1\n"))
+	assert.Empty(t, influx)
+	st.PutPayload("influx", []byte("up value=1\n"))
+	event := <-influx
+	assert.Equal(t, "influx", event.Source)
+}